@@ -0,0 +1,323 @@
+package flatten
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// isArchiveURL reports whether -repo names a .tar.gz or .zip archive
+// rather than a Git repository.
+func isArchiveURL(repoURL string) bool {
+	name := strings.ToLower(strings.SplitN(repoURL, "?", 2)[0])
+	return strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz") || isZipURL(repoURL)
+}
+
+// isZipURL reports whether -repo names a .zip archive, which is read as
+// such instead of as a .tar.gz.
+func isZipURL(repoURL string) bool {
+	return strings.HasSuffix(strings.ToLower(strings.SplitN(repoURL, "?", 2)[0]), ".zip")
+}
+
+// archiveFile is a regular file read from an archive.
+type archiveFile struct {
+	data       []byte
+	executable bool
+}
+
+// archiveRepo downloads a .tar.gz or .zip archive, such as the tarball of
+// a ref that GitHub serves or a repository export, and turns its files
+// into a single commit of an in-memory repository. Everything downstream then works as it does for a
+// clone, without talking to a Git server.
+func archiveRepo(ctx context.Context, opts *Options) (*git.Repository, error) {
+	log := opts.log()
+	start := time.Now()
+	log.Info("download started", "url", opts.RepoURL)
+
+	body, err := openArchive(ctx, opts)
+	if err != nil {
+		log.Error("download failed", "url", opts.RepoURL, "error", err)
+		return nil, err
+	}
+	defer body.Close()
+
+	var files map[string]archiveFile
+	if isZipURL(opts.RepoURL) {
+		files, err = readZip(body)
+	} else {
+		files, err = readTarGz(body)
+	}
+	if err != nil {
+		log.Error("download failed", "url", opts.RepoURL, "error", err)
+		return nil, fmt.Errorf("error reading archive: %w", err)
+	}
+	log.Info("download finished", "url", opts.RepoURL, "files", len(files), "duration", time.Since(start))
+
+	return archiveCommit(files, opts.RepoURL)
+}
+
+// openArchive opens the archive at -repo, a URL or a local path.
+func openArchive(ctx context.Context, opts *Options) (io.ReadCloser, error) {
+	if !strings.Contains(opts.RepoURL, "://") {
+		f, err := os.Open(opts.RepoURL)
+		if err != nil {
+			return nil, fmt.Errorf("error opening archive: %w", err)
+		}
+		return f, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, opts.RepoURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading archive: %w", err)
+	}
+	resp, err := (&http.Client{Transport: httpRoundTripper(opts)}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading archive: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error downloading archive: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// archiveEntryName returns the slash separated path of an archive entry
+// relative to the root of the archive, and false for an entry that would
+// end up outside it, such as proj/../../escaped.txt.
+func archiveEntryName(name string) (string, bool) {
+	name = path.Clean(strings.TrimLeft(name, "/"))
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	return name, true
+}
+
+// readTarGz reads the regular files of a gzipped tarball. Archives of a
+// ref put everything in one top-level directory, which is stripped.
+func readTarGz(r io.Reader) (map[string]archiveFile, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	files := make(map[string]archiveFile)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name, ok := archiveEntryName(hdr.Name)
+		if !ok {
+			continue
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = archiveFile{data: data, executable: hdr.Mode&0111 != 0}
+	}
+	return stripTopDir(files), nil
+}
+
+// readZip reads the regular files of a zip archive. The central directory
+// is at the end, so the whole archive is read into memory first. As with
+// tarballs, a directory holding everything is stripped.
+func readZip(r io.Reader) (map[string]archiveFile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]archiveFile)
+	for _, entry := range zr.File {
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+		name, ok := archiveEntryName(entry.Name)
+		if !ok {
+			continue
+		}
+
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", entry.Name, err)
+		}
+		files[name] = archiveFile{data: data, executable: entry.Mode()&0111 != 0}
+	}
+	return stripTopDir(files), nil
+}
+
+// stripTopDir removes the directory all files are in, if there is one.
+func stripTopDir(files map[string]archiveFile) map[string]archiveFile {
+	top := ""
+	for name := range files {
+		dir, _, ok := strings.Cut(name, "/")
+		if !ok || (top != "" && dir != top) {
+			return files
+		}
+		top = dir
+	}
+
+	stripped := make(map[string]archiveFile, len(files))
+	for name, f := range files {
+		stripped[strings.TrimPrefix(name, top+"/")] = f
+	}
+	return stripped
+}
+
+// archiveCommit stores files as the only commit of a new in-memory
+// repository, with HEAD pointing at it.
+func archiveCommit(files map[string]archiveFile, source string) (*git.Repository, error) {
+	storage := memory.NewStorage()
+	repo, err := git.Init(storage, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every directory maps to its entries, keyed by name.
+	dirs := map[string]map[string]object.TreeEntry{"": {}}
+	var addDir func(dir string)
+	addDir = func(dir string) {
+		if _, ok := dirs[dir]; ok {
+			return
+		}
+		dirs[dir] = make(map[string]object.TreeEntry)
+		parent := path.Dir(dir)
+		if parent == "." {
+			parent = ""
+		}
+		addDir(parent)
+	}
+
+	for name, f := range files {
+		obj := storage.NewEncodedObject()
+		obj.SetType(plumbing.BlobObject)
+		w, err := obj.Writer()
+		if err != nil {
+			return nil, err
+		}
+		_, err = w.Write(f.data)
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+		hash, err := storage.SetEncodedObject(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		mode := filemode.Regular
+		if f.executable {
+			mode = filemode.Executable
+		}
+		dir := path.Dir(name)
+		if dir == "." {
+			dir = ""
+		}
+		addDir(dir)
+		dirs[dir][path.Base(name)] = object.TreeEntry{Name: path.Base(name), Mode: mode, Hash: hash}
+	}
+
+	// Trees are written deepest first, so each directory's hash is known
+	// before its parent is written.
+	names := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		names = append(names, dir)
+	}
+	depth := func(dir string) int {
+		if dir == "" {
+			return 0
+		}
+		return strings.Count(dir, "/") + 1
+	}
+	sort.Slice(names, func(i, j int) bool { return depth(names[i]) > depth(names[j]) })
+
+	var root plumbing.Hash
+	for _, dir := range names {
+		tree := &object.Tree{}
+		for _, entry := range dirs[dir] {
+			tree.Entries = append(tree.Entries, entry)
+		}
+		sort.Sort(object.TreeEntrySorter(tree.Entries))
+
+		obj := storage.NewEncodedObject()
+		err := tree.Encode(obj)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := storage.SetEncodedObject(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		if dir == "" {
+			root = hash
+			continue
+		}
+		parent := path.Dir(dir)
+		if parent == "." {
+			parent = ""
+		}
+		dirs[parent][path.Base(dir)] = object.TreeEntry{Name: path.Base(dir), Mode: filemode.Dir, Hash: hash}
+	}
+
+	sig := object.Signature{Name: "gitflat", When: time.Now()}
+	commit := &object.Commit{
+		Author:    sig,
+		Committer: sig,
+		Message:   "Contents of " + source + "\n",
+		TreeHash:  root,
+	}
+	obj := storage.NewEncodedObject()
+	err = commit.Encode(obj)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := storage.SetEncodedObject(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	err = storage.SetReference(plumbing.NewHashReference(plumbing.Master, hash))
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
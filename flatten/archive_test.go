@@ -0,0 +1,29 @@
+package flatten
+
+import "testing"
+
+func TestArchiveEntryName(t *testing.T) {
+	tests := []struct {
+		name, want string
+		ok         bool
+	}{
+		{"proj/main.go", "proj/main.go", true},
+		{"/proj/main.go", "proj/main.go", true},
+		{"proj/./a//b.go", "proj/a/b.go", true},
+		{"proj/a/../b.go", "proj/b.go", true},
+		{"proj/..x", "proj/..x", true},
+
+		{"..", "", false},
+		{"../x", "", false},
+		{"proj/../../escaped.txt", "", false},
+		{".", "", false},
+		{"/", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := archiveEntryName(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("archiveEntryName(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
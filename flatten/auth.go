@@ -0,0 +1,87 @@
+package flatten
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"golang.org/x/term"
+)
+
+// promptMu keeps the prompts for several -repo values, cloned at the same
+// time, from interleaving.
+var promptMu sync.Mutex
+
+// withAuthPrompt runs clone, and when it fails because the server wants
+// credentials, asks for them on the terminal and runs it once more. Runs
+// that are not interactive, or have -no-prompt, fail as before.
+func withAuthPrompt(opts *Options, clone func() error) error {
+	err := clone()
+	if err == nil || !needsAuth(err) || !canPrompt(opts) {
+		return err
+	}
+
+	auth, promptErr := promptCredentials(opts.RepoURL)
+	if promptErr != nil {
+		return fmt.Errorf("%w (reading credentials: %v)", err, promptErr)
+	}
+	opts.Auth = auth
+	opts.log().Info("retrying with credentials", "url", opts.RepoURL, "username", auth.Username)
+	return clone()
+}
+
+// needsAuth reports whether err means the server rejected the request for
+// lack of valid credentials.
+func needsAuth(err error) bool {
+	return errors.Is(err, transport.ErrAuthenticationRequired) || errors.Is(err, transport.ErrAuthorizationFailed)
+}
+
+// canPrompt reports whether credentials can be asked for: an HTTP(S)
+// remote without credentials yet, with a user at the terminal.
+func canPrompt(opts *Options) bool {
+	if opts.NoPrompt || opts.Auth != nil {
+		return false
+	}
+	if !strings.HasPrefix(opts.RepoURL, "https://") && !strings.HasPrefix(opts.RepoURL, "http://") {
+		return false
+	}
+	return isTerminal(os.Stdin) && isTerminal(os.Stderr)
+}
+
+// promptCredentials asks for a username and a token or password on
+// stderr. The token is read without echoing it. An empty username is
+// replaced with "git", as hosts such as GitHub only look at the token.
+func promptCredentials(repoURL string) (*githttp.BasicAuth, error) {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
+	host := repoURL
+	if u, err := url.Parse(repoURL); err == nil {
+		host = u.Host
+	}
+
+	fmt.Fprintf(os.Stderr, "Authentication required for %s\n", repoURL)
+	fmt.Fprintf(os.Stderr, "Username for %s: ", host)
+	username, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	username = strings.TrimSpace(username)
+	if username == "" {
+		username = "git"
+	}
+
+	fmt.Fprintf(os.Stderr, "Token or password for %s@%s: ", username, host)
+	token, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	return &githttp.BasicAuth{Username: username, Password: string(token)}, nil
+}
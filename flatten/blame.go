@@ -0,0 +1,41 @@
+package flatten
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// blameSummary returns a line naming the most recent commit reachable from
+// from that touched the file at name, or "" when there is none, as for
+// files of submodules. Every call walks the history, so it is only done
+// with -blame-summary.
+func blameSummary(repo *git.Repository, from *object.Commit, name string) (string, error) {
+	commits, err := repo.Log(&git.LogOptions{From: from.Hash, FileName: &name})
+	if err != nil {
+		return "", fmt.Errorf("error reading history of %s: %w", name, err)
+	}
+	defer commits.Close()
+
+	commit, err := commits.Next()
+	if errors.Is(err, io.EOF) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading history of %s: %w", name, err)
+	}
+
+	return fmt.Sprintf("Last commit: %s by %s on %s", commit.Hash.String()[:7], commit.Author.Name, commit.Author.When.Format("2006-01-02")), nil
+}
+
+// blameLine formats a blame summary as the first line of a file's content,
+// as a comment when -comment-style is set.
+func blameLine(summary string, opts *Options) string {
+	if opts.Comment != "" {
+		return opts.Comment + " " + summary
+	}
+	return summary
+}
@@ -0,0 +1,50 @@
+package flatten
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadCABundle reads a PEM bundle of CA certificates for -ca-bundle and
+// returns the system roots with them added. Every certificate must parse,
+// so a malformed bundle is reported before any clone is attempted.
+func loadCABundle(name string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA bundle: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	count := 0
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			if count > 0 && strings.TrimSpace(string(rest)) != "" {
+				return nil, fmt.Errorf("CA bundle %s is malformed: unexpected data after certificate %d", name, count)
+			}
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("CA bundle %s is malformed: certificate %d: %w", name, count+1, err)
+		}
+		pool.AddCert(cert)
+		count++
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("CA bundle %s contains no PEM certificates", name)
+	}
+	return pool, nil
+}
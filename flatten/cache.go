@@ -0,0 +1,92 @@
+package flatten
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// cachedRepo returns a bare clone of the repository kept in the cache
+// directory. The first run clones it; later runs fetch into it, which only
+// transfers new objects. Clones are keyed by repository URL only: every
+// branch and tag is fetched, so one clone serves any -ref.
+func cachedRepo(ctx context.Context, opts *Options) (*git.Repository, error) {
+	sum := sha256.Sum256([]byte(opts.RepoURL))
+	dir := filepath.Join(opts.CacheDir, hex.EncodeToString(sum[:8]))
+
+	log := opts.log()
+	start := time.Now()
+
+	repo, err := git.PlainOpen(dir)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		log.Info("clone started", "url", opts.RepoURL, "path", dir)
+		repo, err = git.PlainCloneContext(ctx, dir, true, &git.CloneOptions{
+			URL:           opts.RepoURL,
+			Auth:          opts.Auth,
+			ReferenceName: opts.DefaultBranch,
+		})
+		if err != nil {
+			log.Error("clone failed", "url", opts.RepoURL, "error", err)
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("error cloning repository: %w", err)
+		}
+		log.Info("clone finished", "url", opts.RepoURL, "duration", time.Since(start))
+		return repo, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening cached clone %s: %w", dir, err)
+	}
+
+	log.Info("fetch started", "url", opts.RepoURL, "path", dir)
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: []gitconfig.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+		Auth:     opts.Auth,
+		Tags:     git.AllTags,
+		Force:    true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		log.Error("fetch failed", "url", opts.RepoURL, "error", err)
+		return nil, fmt.Errorf("error fetching into cached clone: %w", err)
+	}
+
+	err = updateHeadBranch(repo)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("fetch finished", "url", opts.RepoURL, "duration", time.Since(start))
+	return repo, nil
+}
+
+// updateHeadBranch moves the branch HEAD points to onto its freshly
+// fetched remote-tracking branch. Fetching alone leaves it where the
+// original clone put it.
+func updateHeadBranch(repo *git.Repository) error {
+	head, err := repo.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return fmt.Errorf("error getting HEAD: %w", err)
+	}
+	if head.Type() != plumbing.SymbolicReference {
+		return nil
+	}
+
+	branch := head.Target()
+	remote, err := repo.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch.Short()), true)
+	if err != nil {
+		return nil
+	}
+
+	err = repo.Storer.SetReference(plumbing.NewHashReference(branch, remote.Hash()))
+	if err != nil {
+		return fmt.Errorf("error updating %s: %w", branch.Short(), err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package flatten
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checksumsFile is the name of the checksum list written by -checksums.
+const checksumsFile = "SHA256SUMS"
+
+// writeChecksums writes a SHA256SUMS file to destFolder covering every
+// file below it, with paths relative to destFolder. The format is the one
+// produced by sha256sum, so the result can be verified with
+// "sha256sum -c SHA256SUMS" from destFolder.
+func writeChecksums(destFolder string, opts *Options) error {
+	var sums strings.Builder
+	err := filepath.WalkDir(destFolder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(destFolder, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == checksumsFile {
+			return nil
+		}
+
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&sums, "%s  %s\n", sum, rel)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading destination folder: %w", err)
+	}
+
+	err = writeOutput(filepath.Join(destFolder, checksumsFile), []byte(sums.String()), opts)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", checksumsFile, err)
+	}
+	return nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", fmt.Errorf("error hashing %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
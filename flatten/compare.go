@@ -0,0 +1,140 @@
+package flatten
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// compareOutput generates the output for opts and compares it with an
+// existing one, a file for -single output and a folder otherwise. Every
+// difference is printed, and an error is returned when there are any.
+// Single-file output is rendered in memory; the other outputs are written
+// to a temporary folder, which is removed afterwards.
+func compareOutput(ctx context.Context, opts *Options, existing string) error {
+	info, err := os.Stat(existing)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", existing, err)
+	}
+
+	var diffs []string
+	if !info.IsDir() {
+		if !opts.SingleFile || opts.SplitBytes > 0 {
+			return fmt.Errorf("%s is a file, which can only be compared with -single output", existing)
+		}
+
+		var buf bytes.Buffer
+		err = writeSingle(ctx, &buf, opts)
+		if err != nil {
+			return err
+		}
+		want, err := os.ReadFile(existing)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", existing, err)
+		}
+		if diff := compareContent(filepath.Base(existing), want, buf.Bytes()); diff != "" {
+			diffs = append(diffs, diff)
+		}
+	} else {
+		tmp, err := os.MkdirTemp("", "gitflat-compare-")
+		if err != nil {
+			return fmt.Errorf("error creating temporary folder: %w", err)
+		}
+		defer os.RemoveAll(tmp)
+
+		opts.DestFolder = tmp
+		err = run(ctx, opts)
+		if err != nil {
+			return err
+		}
+		diffs, err = compareDirs(existing, tmp)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, diff := range diffs {
+		fmt.Fprintf(messages.w, "  %s\n", diff)
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("output differs from %s in %d file(s)", existing, len(diffs))
+	}
+	return nil
+}
+
+// compareDirs compares the files of the existing output folder with those
+// of a freshly generated one, by relative path.
+func compareDirs(existing, generated string) ([]string, error) {
+	want, err := readTree(existing)
+	if err != nil {
+		return nil, err
+	}
+	got, err := readTree(generated)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []string
+	for name, content := range got {
+		old, ok := want[name]
+		if !ok {
+			diffs = append(diffs, "added: "+name)
+			continue
+		}
+		if diff := compareContent(name, old, content); diff != "" {
+			diffs = append(diffs, diff)
+		}
+	}
+	for name := range want {
+		if _, ok := got[name]; !ok {
+			diffs = append(diffs, "removed: "+name)
+		}
+	}
+	sort.Strings(diffs)
+	return diffs, nil
+}
+
+// readTree reads every regular file below dir, keyed by slash-separated
+// relative path.
+func readTree(dir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = content
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// compareContent describes how got differs from want, by the line of the
+// first difference and the sizes, or returns "" when they are equal.
+func compareContent(name string, want, got []byte) string {
+	if bytes.Equal(want, got) {
+		return ""
+	}
+
+	n := min(len(want), len(got))
+	i := 0
+	for i < n && want[i] == got[i] {
+		i++
+	}
+	line := bytes.Count(want[:i], []byte("\n")) + 1
+	return fmt.Sprintf("changed: %s (first difference at line %d, %d bytes before, %d bytes now)", name, line, len(want), len(got))
+}
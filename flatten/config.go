@@ -0,0 +1,40 @@
+package flatten
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// config is the optional JSON configuration file passed with -config.
+type config struct {
+	// ExtGroups adds extension groups for -exts-group, or replaces the
+	// built-in group of the same name.
+	ExtGroups map[string][]string `json:"ext_groups"`
+
+	// Transforms maps file extensions to the transforms applied to their
+	// content, in order.
+	Transforms map[string][]string `json:"transforms"`
+
+	// LangMap maps file extensions to language identifiers, overriding
+	// the built-in ones; -lang-map overrides it in turn.
+	LangMap map[string]string `json:"lang_map"`
+}
+
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+
+	err = json.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %w", path, err)
+	}
+	return cfg, nil
+}
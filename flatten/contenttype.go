@@ -0,0 +1,37 @@
+package flatten
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"unicode/utf8"
+)
+
+// contentType returns the media type of content as detected from its
+// first bytes, without parameters such as the charset.
+func contentType(content string) string {
+	head := content[:min(len(content), 512)]
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType([]byte(head)))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+// matchesContentType reports whether the detected type of content matches
+// one of patterns, such as text/* or application/json.
+func matchesContentType(content string, patterns []string) bool {
+	mediaType := contentType(content)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, mediaType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isBinary reports whether content is binary, taken to mean anything that
+// is not valid UTF-8 text.
+func isBinary(content string) bool {
+	return !utf8.ValidString(content)
+}
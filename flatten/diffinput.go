@@ -0,0 +1,127 @@
+package flatten
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// loadDiffPaths reads a unified diff, such as the output of git diff, from
+// the file name or from stdin when name is "-", and returns the paths of
+// the files it changes, in order. Deleted files are left out, since they
+// are not in the tree.
+func loadDiffPaths(name string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("error opening diff: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+	current, deleted := "", false
+	flush := func() {
+		if current != "" && !deleted && !seen[current] {
+			seen[current] = true
+			paths = append(paths, current)
+		}
+		current, deleted = "", false
+	}
+
+	// Lines of a hunk can look like headers, e.g. a removed "-- comment",
+	// so the lines left in the current hunk are counted from its header.
+	oldLeft, newLeft := 0, 0
+	gitHeader := false
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(line, "-"):
+				oldLeft--
+			case strings.HasPrefix(line, "+"):
+				newLeft--
+			case strings.HasPrefix(line, `\`):
+			default:
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			// The new path follows the last " b/"; it is overridden by
+			// the +++ line when there is one.
+			flush()
+			gitHeader = true
+			if i := strings.LastIndex(line, " b/"); i >= 0 {
+				current = diffPath(line[i+1:])
+			}
+		case strings.HasPrefix(line, "deleted file mode"):
+			deleted = true
+		case strings.HasPrefix(line, "--- "):
+			// Plain diffs have no diff --git line, so there every file
+			// starts with its --- line.
+			if !gitHeader {
+				flush()
+			}
+		case strings.HasPrefix(line, "+++ "):
+			gitHeader = false
+			target := line[len("+++ "):]
+			if strings.HasPrefix(target, "/dev/null") {
+				deleted = true
+				continue
+			}
+			current = diffPath(target)
+		case strings.HasPrefix(line, "@@ "):
+			oldLeft, newLeft = hunkLengths(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading diff: %w", err)
+	}
+	flush()
+	return paths, nil
+}
+
+// diffPath returns the repository path of a file name in a diff header,
+// without the quotes git adds to unusual names, the b/ prefix and the
+// timestamp of plain diffs.
+func diffPath(name string) string {
+	name, _, _ = strings.Cut(name, "\t")
+	name = strings.Trim(name, `"`)
+	name = strings.TrimPrefix(name, "b/")
+	return path.Clean(name)
+}
+
+// hunkLengths returns the old and new line counts of a hunk header such as
+// "@@ -1,4 +1,5 @@". A count left out is 1.
+func hunkLengths(header string) (oldLines, newLines int) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 {
+		return 0, 0
+	}
+	return rangeLength(fields[1]), rangeLength(fields[2])
+}
+
+func rangeLength(r string) int {
+	_, count, ok := strings.Cut(r, ",")
+	if !ok {
+		return 1
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return 0
+	}
+	return n
+}
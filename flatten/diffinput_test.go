@@ -0,0 +1,93 @@
+package flatten
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadDiffPaths(t *testing.T) {
+	tests := []struct {
+		name, diff string
+		want       []string
+	}{
+		{
+			name: "git diff",
+			diff: `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,2 +1,2 @@
+ package main
+--- not a header
++++ not a header either
+diff --git a/new.go b/new.go
+new file mode 100644
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1 @@
++package main
+diff --git a/gone.go b/gone.go
+deleted file mode 100644
+--- a/gone.go
++++ /dev/null
+@@ -1 +0,0 @@
+-package main
+`,
+			want: []string{"main.go", "new.go"},
+		},
+		{
+			name: "rename and mode change",
+			diff: `diff --git a/old.go b/renamed.go
+similarity index 100%
+rename from old.go
+rename to renamed.go
+diff --git a/run.sh b/run.sh
+old mode 100644
+new mode 100755
+`,
+			want: []string{"renamed.go", "run.sh"},
+		},
+		{
+			name: "plain diff",
+			diff: "--- a/x.txt\t2024-01-01 00:00:00\n+++ b/x.txt\t2024-01-02 00:00:00\n@@ -1 +1 @@\n-a\n+b\n--- a/y.txt\n+++ b/y.txt\n@@ -1 +1 @@\n-c\n+d\n",
+			want: []string{"x.txt", "y.txt"},
+		},
+		{
+			name: "quoted name",
+			diff: "diff --git \"a/with space.go\" \"b/with space.go\"\n--- \"a/with space.go\"\n+++ \"b/with space.go\"\n@@ -1 +1 @@\n-a\n+b\n",
+			want: []string{"with space.go"},
+		},
+		{
+			name: "repeated file",
+			diff: "--- a/x.txt\n+++ b/x.txt\n@@ -1 +1 @@\n-a\n+b\n--- a/x.txt\n+++ b/x.txt\n@@ -5 +5 @@\n-c\n+d\n",
+			want: []string{"x.txt"},
+		},
+		{
+			name: "empty",
+			diff: "",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "changes.diff")
+			if err := os.WriteFile(name, []byte(tt.diff), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadDiffPaths(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadDiffPaths = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := loadDiffPaths(filepath.Join(t.TempDir(), "missing.diff")); err == nil {
+		t.Error("loadDiffPaths of a missing file succeeded")
+	}
+}
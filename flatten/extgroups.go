@@ -0,0 +1,63 @@
+package flatten
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// extGroups are the built-in named sets of extensions for -exts-group.
+var extGroups = map[string][]string{
+	"code": {
+		".go", ".py", ".js", ".mjs", ".cjs", ".jsx", ".ts", ".tsx", ".java", ".kt", ".scala",
+		".c", ".h", ".cc", ".cpp", ".cxx", ".hpp", ".cs", ".rs", ".rb", ".php", ".swift",
+		".m", ".lua", ".pl", ".r", ".sh", ".bash", ".zsh", ".ps1", ".sql", ".dart",
+		".ex", ".exs", ".erl", ".hs", ".clj", ".el", ".vim", ".proto",
+	},
+	"docs":   {".md", ".rst", ".txt", ".adoc"},
+	"config": {".yaml", ".yml", ".json", ".toml", ".ini", ".cfg", ".conf", ".env", ".properties", ".xml"},
+	"web":    {".html", ".htm", ".css", ".scss", ".sass", ".less", ".js", ".ts", ".jsx", ".tsx", ".vue", ".svelte"},
+}
+
+// expandExtGroups returns the extensions of the named groups. Groups from
+// the config file take precedence over the built-in ones.
+func expandExtGroups(names []string, cfg *config) ([]string, error) {
+	var exts []string
+	for _, name := range names {
+		group, ok := cfg.ExtGroups[name]
+		if !ok {
+			group, ok = extGroups[name]
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown extension group %q (available: %s)", name, strings.Join(groupNames(cfg), ", "))
+		}
+		exts = append(exts, group...)
+	}
+	return exts, nil
+}
+
+func groupNames(cfg *config) []string {
+	var names []string
+	for name := range extGroups {
+		names = append(names, name)
+	}
+	for name := range cfg.ExtGroups {
+		if _, ok := extGroups[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// splitList splits a comma-separated flag value, dropping blank items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
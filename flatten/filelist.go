@@ -0,0 +1,126 @@
+package flatten
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// shallowFileListMax is the largest -filelist for which only the latest
+// commit is cloned. Longer lists are usually a large part of the tree, so
+// a full clone costs little more.
+const shallowFileListMax = 50
+
+// loadFileList reads the paths listed in a -filelist file, one per line.
+// Blank lines and lines starting with # are ignored. Lines may also be
+// glob patterns, where ** matches any number of directories.
+func loadFileList(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file list: %w", err)
+	}
+	defer f.Close()
+
+	var files []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		files = append(files, path.Clean(strings.TrimPrefix(line, "/")))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading file list: %w", err)
+	}
+	return files, nil
+}
+
+// shallowClone reports whether a depth-1 clone is enough for the run.
+// go-git cannot fetch individual blobs, so fetching just the latest commit
+// is the closest it gets for a short -filelist. Other refs, -added-since,
+// -changed-since, -merge-base, -since-days, -recency-since and
+// -blame-summary need more history than that.
+func shallowClone(opts *Options) bool {
+	return len(opts.FileList) > 0 && len(opts.FileList) <= shallowFileListMax &&
+		opts.Ref == "" && opts.AddedSince == "" && opts.ChangedSince == "" && opts.MergeBase == "" && opts.SinceDays == 0 && opts.RecencySince.IsZero() && !opts.BlameSummary
+}
+
+// fileList matches paths against the entries of a -filelist.
+type fileList struct {
+	// paths are the entries without wildcards, matched exactly.
+	paths    []string
+	exact    map[string]bool
+	patterns []string
+	matched  map[string]bool
+}
+
+func newFileList(entries []string) *fileList {
+	l := &fileList{exact: make(map[string]bool), matched: make(map[string]bool)}
+	for _, entry := range entries {
+		if strings.ContainsAny(entry, "*?[") {
+			l.patterns = append(l.patterns, entry)
+			continue
+		}
+		if !l.exact[entry] {
+			l.exact[entry] = true
+			l.paths = append(l.paths, entry)
+		}
+	}
+	return l
+}
+
+// match reports whether name is listed or matches one of the patterns,
+// and records which patterns matched.
+func (l *fileList) match(name string) bool {
+	found := l.exact[name]
+	for _, pattern := range l.patterns {
+		if matchGlob(pattern, name) {
+			l.matched[pattern] = true
+			found = true
+		}
+	}
+	return found
+}
+
+// unmatched returns the patterns that have not matched any path.
+func (l *fileList) unmatched() []string {
+	var patterns []string
+	for _, pattern := range l.patterns {
+		if !l.matched[pattern] {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// matchGlob matches a slash-separated path against a pattern in the
+// syntax of path.Match, extended so that a ** element matches zero or more
+// directories.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
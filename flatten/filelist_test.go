@@ -0,0 +1,35 @@
+package flatten
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"main.go", "main.go", true},
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"cmd/*.go", "cmd/main.go", true},
+		{"cmd/*", "cmd/tool/main.go", false},
+
+		// ** matches zero or more directories.
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "cmd/tool/main.go", true},
+		{"cmd/**", "cmd/tool/main.go", true},
+		{"cmd/**", "cmd", true},
+		{"cmd/**/main.go", "cmd/main.go", true},
+		{"cmd/**/main.go", "cmd/a/b/main.go", true},
+		{"cmd/**/main.go", "pkg/cmd/main.go", false},
+		{"**/testdata/**", "a/testdata/x/y.txt", true},
+		{"**/testdata/**", "a/data/y.txt", false},
+
+		{"[", "[", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
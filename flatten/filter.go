@@ -0,0 +1,94 @@
+package flatten
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// runFilter pipes content through the -filter-cmd command and returns
+// what it writes to stdout, like a Git clean filter. The command runs
+// without a shell and gets the file's path in $GITFLAT_PATH. It fails when
+// it exits nonzero or takes longer than opts.FilterTimeout.
+func runFilter(ctx context.Context, name, content string, opts *Options) (string, error) {
+	if opts.FilterTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.FilterTimeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, opts.FilterCmd[0], opts.FilterCmd[1:]...)
+	cmd.Env = append(os.Environ(), "GITFLAT_PATH="+name)
+	cmd.Stdin = strings.NewReader(content)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Children of a killed command can keep its output open; stop waiting
+	// for them soon after.
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("-filter-cmd timed out after %s", opts.FilterTimeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("-filter-cmd failed: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("-filter-cmd failed: %w", err)
+	}
+	return stdout.String(), nil
+}
+
+// splitCommand splits a -filter-cmd value into arguments at unquoted
+// whitespace. Single and double quotes group words as in a shell, and a
+// backslash outside single quotes escapes the next character; nothing is
+// expanded.
+func splitCommand(value string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range value {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", value)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return args, nil
+}
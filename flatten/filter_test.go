@@ -0,0 +1,43 @@
+package flatten
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{"gofmt", []string{"gofmt"}, false},
+		{"  sed  -e s/a/b/ ", []string{"sed", "-e", "s/a/b/"}, false},
+		{`sed -e 's/a b/c/'`, []string{"sed", "-e", "s/a b/c/"}, false},
+		{`echo "a 'b' c"`, []string{"echo", "a 'b' c"}, false},
+		{`echo 'a "b" c'`, []string{"echo", `a "b" c`}, false},
+		{`echo a\ b`, []string{"echo", "a b"}, false},
+		{`echo 'a\ b'`, []string{"echo", `a\ b`}, false},
+		{`echo "a\"b"`, []string{"echo", `a"b`}, false},
+		{`echo ""`, []string{"echo", ""}, false},
+		{"echo $HOME", []string{"echo", "$HOME"}, false},
+		{"a\tb\nc", []string{"a", "b", "c"}, false},
+
+		{"", nil, true},
+		{"   ", nil, true},
+		{`echo 'a`, nil, true},
+		{`echo "a`, nil, true},
+		{`echo a\`, nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := splitCommand(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitCommand(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitCommand(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
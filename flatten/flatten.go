@@ -0,0 +1,42 @@
+// Package flatten flattens the files of a git repository into a single
+// stream or a folder. It implements the gitflat command, and FlattenTo
+// and FlattenRepo make its outputs available to other programs.
+package flatten
+
+import (
+	"context"
+	"io"
+	"runtime"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// FlattenTo clones opts.RepoURL, or opens it when it is a local path or an
+// archive, and writes its selected files to w as the command's -single
+// output would, in opts.Format. Nothing is written to disk unless
+// opts.CacheDir is set. A zero opts.Jobs transforms as many files in
+// parallel as there are CPUs.
+func FlattenTo(ctx context.Context, w io.Writer, opts Options) error {
+	if opts.Jobs <= 0 {
+		opts.Jobs = runtime.NumCPU()
+	}
+	configureRepo(&opts, opts.Archive, opts.CacheDir)
+	installHTTPTransport(&opts)
+	return flattenTo(ctx, w, &opts)
+}
+
+// FlattenRepo writes the output opts select, as the command would, from a
+// repository the caller already has, without cloning opts.RepoURL. The
+// tree is the one opts.Ref resolves to in repo, or HEAD. opts.RepoURL is
+// only used in messages and may be empty.
+func FlattenRepo(ctx context.Context, repo *git.Repository, opts Options) error {
+	if opts.Jobs <= 0 {
+		opts.Jobs = runtime.NumCPU()
+	}
+	opts.repo = repo
+	// There is no checkout to flatten, so the files are read from the
+	// repository's objects.
+	opts.Bare = true
+	opts.Local, opts.Archive, opts.CacheDir, opts.Mirror = false, false, "", false
+	return run(ctx, &opts)
+}
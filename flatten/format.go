@@ -0,0 +1,318 @@
+package flatten
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// formatter renders a sequence of files into a single output stream.
+// Formatters are stateful, so each output needs its own.
+type formatter interface {
+	// ext is the extension of files written in this format.
+	ext() string
+	begin(w io.Writer) error
+	file(w io.Writer, name, content string) error
+	end(w io.Writer) error
+}
+
+func newFormatter(opts *Options) formatter {
+	switch opts.Format {
+	case "json":
+		return &jsonFormatter{pretty: opts.Pretty, binaryBase64: opts.BinaryBase64}
+	case "jsonl":
+		return &jsonlFormatter{binaryBase64: opts.BinaryBase64}
+	case "csv":
+		return &csvFormatter{withContent: opts.WithContent}
+	case "org":
+		return &orgFormatter{}
+	case "markdown":
+		// Grouped files are nested under their language heading.
+		heading := "##"
+		if opts.GroupByLanguage {
+			heading = "###"
+		}
+		return &markdownFormatter{collapsible: opts.Collapsible, position: opts.HeaderPosition, heading: heading}
+	default:
+		return &plainFormatter{opts: opts}
+	}
+}
+
+// plainFormatter writes each file introduced by a separator line.
+type plainFormatter struct {
+	opts *Options
+}
+
+func (f *plainFormatter) ext() string { return ".txt" }
+
+func (f *plainFormatter) begin(w io.Writer) error { return nil }
+
+func (f *plainFormatter) file(w io.Writer, name, content string) error {
+	var b strings.Builder
+	if headerOnTop(f.opts.HeaderPosition) {
+		b.WriteString(separator(name, len(content), f.opts) + "\n")
+	}
+	b.WriteString(content)
+	if footerAtBottom(f.opts.HeaderPosition) {
+		if !strings.HasSuffix(content, "\n") {
+			b.WriteString("\n")
+		}
+		b.WriteString(separator("end of "+name, len(content), f.opts) + "\n")
+	}
+	b.WriteString(f.opts.Trailing)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// headerOnTop and footerAtBottom interpret -header-position, which is
+// "top" when unset.
+func headerOnTop(position string) bool { return position != "bottom" }
+
+func footerAtBottom(position string) bool { return position == "bottom" || position == "both" }
+
+func (f *plainFormatter) end(w io.Writer) error { return nil }
+
+// separator returns the line that introduces a file in plain output.
+// With -length-prefix it also carries the size of the content that
+// follows, so a parser can read exactly that many bytes instead of
+// scanning for the next separator, which the content could contain.
+func separator(name string, size int, opts *Options) string {
+	if opts.LengthPrefix {
+		name = fmt.Sprintf("%s (%d bytes)", name, size)
+	}
+	if opts.Comment != "" {
+		return fmt.Sprintf("%s --- %s ---", opts.Comment, name)
+	}
+	return fmt.Sprintf("--- %s ---", name)
+}
+
+// jsonFile is a file as it appears in JSON output.
+type jsonFile struct {
+	Path     string `json:"path"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// newJSONFile returns the JSON entry for a file. JSON strings can only
+// hold UTF-8, so with binaryBase64 binary content is base64-encoded and
+// marked as such instead of having its invalid bytes replaced.
+func newJSONFile(name, content string, binaryBase64 bool) jsonFile {
+	if binaryBase64 && isBinary(content) {
+		return jsonFile{Path: name, Content: base64.StdEncoding.EncodeToString([]byte(content)), Encoding: "base64"}
+	}
+	return jsonFile{Path: name, Content: content}
+}
+
+// jsonFormatter writes a {"files": [...]} document. Files are encoded as
+// they arrive, so the output is streamed rather than built in memory.
+type jsonFormatter struct {
+	pretty       bool
+	binaryBase64 bool
+	count        int
+}
+
+func (f *jsonFormatter) ext() string { return ".json" }
+
+func (f *jsonFormatter) begin(w io.Writer) error {
+	if f.pretty {
+		_, err := io.WriteString(w, "{\n  \"files\": [")
+		return err
+	}
+	_, err := io.WriteString(w, `{"files":[`)
+	return err
+}
+
+func (f *jsonFormatter) file(w io.Writer, name, content string) error {
+	var buf bytes.Buffer
+	if f.count > 0 {
+		buf.WriteByte(',')
+	}
+	if f.pretty {
+		buf.WriteString("\n    ")
+	}
+
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if f.pretty {
+		enc.SetIndent("    ", "  ")
+	}
+	err := enc.Encode(newJSONFile(name, content, f.binaryBase64))
+	if err != nil {
+		return err
+	}
+	// Encode terminates every value with a newline, which would break up
+	// the compact form.
+	buf.Truncate(buf.Len() - 1)
+
+	f.count++
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func (f *jsonFormatter) end(w io.Writer) error {
+	if !f.pretty {
+		_, err := io.WriteString(w, "]}\n")
+		return err
+	}
+	if f.count > 0 {
+		_, err := io.WriteString(w, "\n  ]\n}\n")
+		return err
+	}
+	_, err := io.WriteString(w, "]\n}\n")
+	return err
+}
+
+// jsonlFormatter writes one JSON object per line and file, so consumers
+// can process the output line by line as it is produced.
+type jsonlFormatter struct {
+	binaryBase64 bool
+}
+
+func (f *jsonlFormatter) ext() string { return ".jsonl" }
+
+func (f *jsonlFormatter) begin(w io.Writer) error { return nil }
+
+func (f *jsonlFormatter) file(w io.Writer, name, content string) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(newJSONFile(name, content, f.binaryBase64))
+}
+
+func (f *jsonlFormatter) end(w io.Writer) error { return nil }
+
+// csvFormatter writes a table with a row of metadata per file, for
+// spreadsheets and data tools. The content is only included as a last
+// column with -with-content.
+type csvFormatter struct {
+	withContent bool
+	cw          *csv.Writer
+}
+
+func (f *csvFormatter) ext() string { return ".csv" }
+
+func (f *csvFormatter) begin(w io.Writer) error {
+	f.cw = csv.NewWriter(w)
+	header := []string{"path", "size", "lines", "ext", "sha256"}
+	if f.withContent {
+		header = append(header, "content")
+	}
+	return f.cw.Write(header)
+}
+
+func (f *csvFormatter) file(w io.Writer, name, content string) error {
+	sum := sha256.Sum256([]byte(content))
+	row := []string{
+		name,
+		strconv.Itoa(len(content)),
+		strconv.Itoa(lineCount(content)),
+		path.Ext(name),
+		hex.EncodeToString(sum[:]),
+	}
+	if f.withContent {
+		row = append(row, content)
+	}
+	return f.cw.Write(row)
+}
+
+func (f *csvFormatter) end(w io.Writer) error {
+	f.cw.Flush()
+	return f.cw.Error()
+}
+
+// orgFormatter writes an Org-mode document with a heading per file and its
+// content in a source block.
+type orgFormatter struct{}
+
+func (f *orgFormatter) ext() string { return ".org" }
+
+func (f *orgFormatter) begin(w io.Writer) error { return nil }
+
+func (f *orgFormatter) file(w io.Writer, name, content string) error {
+	blockStart, blockEnd := "#+BEGIN_EXAMPLE", "#+END_EXAMPLE"
+	if lang := language(name); lang != "" {
+		blockStart, blockEnd = "#+BEGIN_SRC "+lang, "#+END_SRC"
+	}
+
+	content = orgEscape(content)
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	_, err := fmt.Fprintf(w, "* %s\n%s\n%s%s\n\n", name, blockStart, content, blockEnd)
+	return err
+}
+
+func (f *orgFormatter) end(w io.Writer) error { return nil }
+
+// orgSpecialLine matches lines Org would read as markup inside a block.
+var orgSpecialLine = regexp.MustCompile(`(?m)^(\s*)(,*(?:\*|#\+))`)
+
+// orgEscape protects lines starting with "*" or "#+" by prefixing them
+// with a comma, the way Org itself escapes block contents.
+func orgEscape(content string) string {
+	return orgSpecialLine.ReplaceAllString(content, "$1,$2")
+}
+
+// markdownFormatter writes a Markdown document with a heading and a fenced
+// code block per file. With -collapsible each file is wrapped in a
+// <details> block instead, so long documents stay navigable on GitHub.
+type markdownFormatter struct {
+	collapsible bool
+	position    string
+	heading     string
+}
+
+func (f *markdownFormatter) ext() string { return ".md" }
+
+func (f *markdownFormatter) begin(w io.Writer) error { return nil }
+
+func (f *markdownFormatter) file(w io.Writer, name, content string) error {
+	fence := markdownFence(content)
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	block := fmt.Sprintf("%s%s\n%s%s\n", fence, language(name), content, fence)
+
+	var err error
+	if f.collapsible {
+		_, err = fmt.Fprintf(w, "<details>\n<summary>%s</summary>\n\n%s\n</details>\n\n", html.EscapeString(name), block)
+	} else {
+		var b strings.Builder
+		if headerOnTop(f.position) {
+			fmt.Fprintf(&b, "%s %s\n\n", f.heading, name)
+		}
+		b.WriteString(block + "\n")
+		if footerAtBottom(f.position) {
+			fmt.Fprintf(&b, "_End of %s_\n\n", name)
+		}
+		_, err = io.WriteString(w, b.String())
+	}
+	return err
+}
+
+func (f *markdownFormatter) end(w io.Writer) error { return nil }
+
+// markdownFence returns a code fence longer than any run of backticks in
+// content, so the content cannot close the block early.
+func markdownFence(content string) string {
+	longest, run := 0, 0
+	for _, c := range content {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
@@ -0,0 +1,58 @@
+package flatten
+
+import (
+	"path"
+	"strings"
+)
+
+// generatedSuffixes are file name endings of well-known code generators:
+// protobuf and gRPC, Go generators, Dart's build_runner and Kubernetes'
+// deepcopy-gen.
+var generatedSuffixes = []string{
+	".pb.go", ".pb.gw.go", "_gen.go", ".gen.go", "_generated.go",
+	"_pb2.py", "_pb2_grpc.py", ".pb.h", ".pb.cc",
+	".g.dart", ".freezed.dart",
+}
+
+// generatedMarkers are phrases generators put in the header of the files
+// they write, such as Go's "// Code generated ... DO NOT EDIT."
+var generatedMarkers = []string{
+	"code generated", "do not edit", "@generated", "autogenerated", "auto-generated",
+}
+
+// generatedHeaderLines is how many lines at the start of a file are
+// searched for generatedMarkers.
+const generatedHeaderLines = 10
+
+// isGeneratedName reports whether a file name matches a known generated
+// pattern, which can be decided before the file is read.
+func isGeneratedName(name string) bool {
+	base := path.Base(name)
+	if strings.HasPrefix(base, "zz_generated.") {
+		return true
+	}
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(base, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasGeneratedHeader reports whether one of the first lines of content
+// contains a generation marker.
+func hasGeneratedHeader(content string) bool {
+	lines := strings.SplitN(content, "\n", generatedHeaderLines+1)
+	for i, line := range lines {
+		if i == generatedHeaderLines {
+			break
+		}
+		line = strings.ToLower(line)
+		for _, marker := range generatedMarkers {
+			if strings.Contains(line, marker) {
+				return true
+			}
+		}
+	}
+	return false
+}
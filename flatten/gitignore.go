@@ -0,0 +1,91 @@
+package flatten
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// ignoreMatcher compiles the ignore rules for -respect-gitignore: the
+// repository's info/exclude file for a local -repo, then every .gitignore
+// file of tree. Patterns are ordered by increasing priority, as git does:
+// info/exclude first, then .gitignore files from the root down, so a rule
+// in a deeper directory overrides one above it.
+func ignoreMatcher(tree *object.Tree, opts *Options) (gitignore.Matcher, error) {
+	var patterns []gitignore.Pattern
+
+	if opts.Local {
+		exclude, err := readExcludeFile(opts.RepoURL)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, exclude...)
+	}
+
+	var files []*object.File
+	err := tree.Files().ForEach(func(f *object.File) error {
+		if path.Base(f.Name) == ".gitignore" {
+			files = append(files, f)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error finding .gitignore files: %w", err)
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return strings.Count(files[i].Name, "/") < strings.Count(files[j].Name, "/")
+	})
+
+	for _, f := range files {
+		content, err := f.Contents()
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", f.Name, err)
+		}
+		var domain []string
+		if dir := path.Dir(f.Name); dir != "." {
+			domain = strings.Split(dir, "/")
+		}
+		patterns = append(patterns, parseIgnorePatterns(content, domain)...)
+	}
+
+	return gitignore.NewMatcher(patterns), nil
+}
+
+// readExcludeFile reads the info/exclude file of the local repository at
+// dir, which is either a working tree or a bare repository. A missing file
+// has no patterns.
+func readExcludeFile(dir string) ([]gitignore.Pattern, error) {
+	for _, name := range []string{filepath.Join(dir, ".git", "info", "exclude"), filepath.Join(dir, "info", "exclude")} {
+		content, err := os.ReadFile(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", name, err)
+		}
+		return parseIgnorePatterns(string(content), nil), nil
+	}
+	return nil, nil
+}
+
+// parseIgnorePatterns parses the lines of an ignore file whose rules apply
+// to the directory domain.
+func parseIgnorePatterns(content string, domain []string) []gitignore.Pattern {
+	var patterns []gitignore.Pattern
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, domain))
+	}
+	return patterns
+}
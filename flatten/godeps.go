@@ -0,0 +1,159 @@
+package flatten
+
+import (
+	"go/parser"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// sortGoDeps orders files for -sort go-deps: every file that is not Go
+// source first, in tree order, then the Go files package by package, with
+// the packages of the repository a package imports before it. Files of a
+// package keep their tree order.
+//
+// The order is best-effort. Imports are read from the files as they are in
+// the tree, test files are left out of the graph, and each import cycle is
+// broken at the package that comes first in tree order. It returns the
+// number of times a cycle had to be broken.
+func sortGoDeps(files []*object.File) ([]*object.File, int) {
+	modules := goModules(files)
+
+	var ordered []*object.File
+	var dirs []string
+	pkgFiles := make(map[string][]*object.File)
+	imports := make(map[string]map[string]bool)
+	for _, f := range files {
+		if path.Ext(f.Name) != ".go" {
+			ordered = append(ordered, f)
+			continue
+		}
+
+		dir := path.Dir(f.Name)
+		if pkgFiles[dir] == nil {
+			dirs = append(dirs, dir)
+			imports[dir] = make(map[string]bool)
+		}
+		pkgFiles[dir] = append(pkgFiles[dir], f)
+		if strings.HasSuffix(f.Name, "_test.go") {
+			continue
+		}
+		for _, imp := range goImports(f) {
+			if dep, ok := packageDir(imp, modules); ok && dep != dir {
+				imports[dir][dep] = true
+			}
+		}
+	}
+
+	// Packages are placed one at a time: the first one in tree order whose
+	// imports are all placed, or, when a cycle leaves none, the first one
+	// not yet placed.
+	placed := make(map[string]bool)
+	cycles := 0
+	for len(placed) < len(dirs) {
+		next := ""
+		for _, dir := range dirs {
+			if !placed[dir] && importsPlaced(imports[dir], placed, pkgFiles) {
+				next = dir
+				break
+			}
+		}
+		if next == "" {
+			cycles++
+			for _, dir := range dirs {
+				if !placed[dir] {
+					next = dir
+					break
+				}
+			}
+		}
+		placed[next] = true
+		ordered = append(ordered, pkgFiles[next]...)
+	}
+	return ordered, cycles
+}
+
+// importsPlaced reports whether every imported package with Go files in
+// the tree is placed. Imports that resolve to a directory without any are
+// ignored.
+func importsPlaced(deps map[string]bool, placed map[string]bool, pkgFiles map[string][]*object.File) bool {
+	for dep := range deps {
+		if pkgFiles[dep] != nil && !placed[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+// goModules maps the directories of the go.mod files among files to the
+// module paths they declare.
+func goModules(files []*object.File) map[string]string {
+	modules := make(map[string]string)
+	for _, f := range files {
+		if path.Base(f.Name) != "go.mod" {
+			continue
+		}
+		content, err := f.Contents()
+		if err != nil {
+			continue
+		}
+		if module := modulePath(content); module != "" {
+			modules[path.Dir(f.Name)] = module
+		}
+	}
+	return modules
+}
+
+// modulePath returns the path in the module directive of a go.mod file.
+func modulePath(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "module" {
+			if unquoted, err := strconv.Unquote(fields[1]); err == nil {
+				return unquoted
+			}
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// goImports returns the import paths of a Go file, or none when it cannot
+// be parsed.
+func goImports(f *object.File) []string {
+	content, err := f.Contents()
+	if err != nil {
+		return nil
+	}
+	parsed, err := parser.ParseFile(token.NewFileSet(), f.Name, content, parser.ImportsOnly)
+	if err != nil {
+		return nil
+	}
+
+	var paths []string
+	for _, spec := range parsed.Imports {
+		if imp, err := strconv.Unquote(spec.Path.Value); err == nil {
+			paths = append(paths, imp)
+		}
+	}
+	return paths
+}
+
+// packageDir returns the repository directory of the package imported as
+// imp, when it belongs to one of modules.
+func packageDir(imp string, modules map[string]string) (string, bool) {
+	// The longest module path wins, for nested modules.
+	best, bestModule := "", ""
+	for dir, module := range modules {
+		if (imp == module || strings.HasPrefix(imp, module+"/")) && len(module) > len(bestModule) {
+			best, bestModule = dir, module
+		}
+	}
+	if bestModule == "" {
+		return "", false
+	}
+	return path.Join(best, strings.TrimPrefix(imp, bestModule)), true
+}
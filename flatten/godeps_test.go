@@ -0,0 +1,86 @@
+package flatten
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestSortGoDeps(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string]string
+		want       []string
+		wantCycles int
+	}{
+		{
+			name: "imports first",
+			files: map[string]string{
+				"go.mod":    "module example.com/m\n",
+				"README.md": "# m\n",
+				"main.go":   "package main\n\nimport \"example.com/m/a\"\n",
+				"a/a.go":    "package a\n\nimport (\n\t\"fmt\"\n\t\"example.com/m/b\"\n)\n",
+				"b/b.go":    "package b\n\nimport \"example.com/m/c\"\n",
+				"c/c.go":    "package c\n",
+			},
+			want: []string{"README.md", "go.mod", "c/c.go", "b/b.go", "a/a.go", "main.go"},
+		},
+		{
+			name: "test files do not count",
+			files: map[string]string{
+				"go.mod":      "module example.com/m\n",
+				"a/a.go":      "package a\n",
+				"a/a_test.go": "package a\n\nimport \"example.com/m/b\"\n",
+				"b/b.go":      "package b\n\nimport \"example.com/m/a\"\n",
+			},
+			want: []string{"go.mod", "a/a.go", "a/a_test.go", "b/b.go"},
+		},
+		{
+			name: "cycle broken in tree order",
+			files: map[string]string{
+				"go.mod": "module example.com/m\n",
+				"x/x.go": "package x\n\nimport \"example.com/m/y\"\n",
+				"y/y.go": "package y\n\nimport \"example.com/m/x\"\n",
+				"z/z.go": "package z\n\nimport \"example.com/m/x\"\n",
+			},
+			want:       []string{"go.mod", "x/x.go", "y/y.go", "z/z.go"},
+			wantCycles: 1,
+		},
+		{
+			name: "nested module",
+			files: map[string]string{
+				"go.mod":        "module example.com/m\n",
+				"a/a.go":        "package a\n\nimport \"example.com/tools/t\"\n",
+				"tools/go.mod":  "module example.com/tools\n",
+				"tools/t/t.go":  "package t\n",
+				"unparsable.go": "not go\n",
+				"vendored/v.go": "package v\n\nimport \"golang.org/x/text\"\n",
+			},
+			want: []string{"go.mod", "tools/go.mod", "tools/t/t.go", "a/a.go", "unparsable.go", "vendored/v.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, tree := testRepo(t, tt.files)
+			var files []*object.File
+			err := tree.Files().ForEach(func(f *object.File) error {
+				files = append(files, f)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sorted, cycles := sortGoDeps(files)
+			var got []string
+			for _, f := range sorted {
+				got = append(got, f.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) || cycles != tt.wantCycles {
+				t.Errorf("sortGoDeps = %q, %d cycles, want %q, %d cycles", got, cycles, tt.want, tt.wantCycles)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package flatten
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+// changedFiles returns the changes that turn the tree of base into tree,
+// keyed by path, for the files that were added or modified. Deleted files
+// are not part of tree, so they are left out.
+func changedFiles(repo *git.Repository, tree *object.Tree, base string) (map[string]*object.Change, error) {
+	commit, err := resolveCommit(repo, base)
+	if err != nil {
+		return nil, err
+	}
+
+	baseTree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("error getting tree for %s: %w", base, err)
+	}
+
+	changes, err := object.DiffTree(baseTree, tree)
+	if err != nil {
+		return nil, fmt.Errorf("error comparing with %s: %w", base, err)
+	}
+
+	changed := make(map[string]*object.Change)
+	for _, change := range changes {
+		action, err := change.Action()
+		if err != nil {
+			return nil, err
+		}
+		if action != merkletrie.Delete {
+			changed[change.To.Name] = change
+		}
+	}
+	return changed, nil
+}
+
+// changeHunks renders the hunks of a change as unified diff, with three
+// lines of context. Every hunk header names the file as well as the line
+// ranges, e.g. "@@ main.go -10,7 +10,9 @@", so hunks stay attributable
+// when they are read on their own. Binary changes have no hunks.
+func changeHunks(change *object.Change, name string) (string, error) {
+	patch, err := change.Patch()
+	if err != nil {
+		return "", fmt.Errorf("error computing diff of %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	err = patch.Encode(&buf)
+	if err != nil {
+		return "", fmt.Errorf("error computing diff of %s: %w", name, err)
+	}
+
+	// The encoder starts with the diff --git, index, --- and +++ lines,
+	// which the file separator already covers.
+	var b strings.Builder
+	inHunk := false
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if strings.HasPrefix(line, "@@ ") {
+			inHunk = true
+			line = "@@ " + name + " " + strings.TrimPrefix(line, "@@ ")
+		}
+		if inHunk {
+			b.WriteString(line)
+		}
+	}
+	return b.String(), nil
+}
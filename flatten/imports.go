@@ -0,0 +1,207 @@
+package flatten
+
+import (
+	"regexp"
+	"strings"
+)
+
+// importStatement returns the end, exclusive, of the import statement
+// starting at lines[i], or -1 when lines[i] does not start one.
+type importStatement func(lines []string, i int) int
+
+// importHeader returns the end, exclusive, of the blank line, comment,
+// docstring or other non-import line starting at lines[i] that may sit
+// among the imports at the top of a file, or -1 when lines[i] ends them.
+type importHeader func(lines []string, i int) int
+
+// importExts are the extensions stripImports knows the imports of.
+var importExts = map[string]bool{
+	".go": true, ".py": true,
+	".js": true, ".mjs": true, ".cjs": true, ".jsx": true, ".ts": true, ".tsx": true,
+}
+
+// stripImports removes the import statements of Go, Python, JavaScript
+// and TypeScript files and returns other content unchanged. Only the
+// block of imports at the top of a file is stripped: it ends at the first
+// line that is not an import, a comment, a docstring or the package
+// clause, so nothing is taken from strings or code further down. Only
+// statements starting in the first column are recognized, and one that
+// cannot be delimited with certainty is kept.
+func stripImports(name, content string) string {
+	var statement importStatement
+	var header importHeader
+	switch syntaxExt(name, func(ext string) bool { return importExts[ext] }) {
+	case ".go":
+		statement, header = goImport, goHeader
+	case ".py":
+		statement, header = pythonImport, pythonHeader
+	case ".js", ".mjs", ".cjs", ".jsx", ".ts", ".tsx":
+		statement, header = jsImport, jsHeader
+	default:
+		return content
+	}
+
+	lines := strings.Split(content, "\n")
+	kept := make([]string, 0, len(lines))
+	removed, done := false, false
+	for i := 0; i < len(lines); i++ {
+		if !done {
+			if end := statement(lines, i); end > i {
+				i = end - 1
+				removed = true
+				continue
+			}
+			if end := header(lines, i); end > i+1 {
+				// A multi-line comment or docstring is kept as a whole.
+				kept = append(kept, lines[i:end]...)
+				i = end - 1
+				removed = false
+				continue
+			} else if end < 0 {
+				done = true
+			}
+		}
+		// Drop the blank line that separated a removed block from the
+		// rest, unless it is the only separation left.
+		if removed && strings.TrimSpace(lines[i]) == "" && (len(kept) == 0 || strings.TrimSpace(kept[len(kept)-1]) == "") {
+			continue
+		}
+		removed = false
+		kept = append(kept, lines[i])
+	}
+	return strings.Join(kept, "\n")
+}
+
+// blockEnd returns the end, exclusive, of the block that starts after
+// the first open on lines[i] and runs up to the next close, or -1 when it
+// is not closed.
+func blockEnd(lines []string, i int, open, close string) int {
+	rest := lines[i][strings.Index(lines[i], open)+len(open):]
+	for j := i; j < len(lines); j++ {
+		if strings.Contains(rest, close) {
+			return j + 1
+		}
+		if j+1 < len(lines) {
+			rest = lines[j+1]
+		}
+	}
+	return -1
+}
+
+// cHeader recognizes the blank lines and // and /* */ comments that Go,
+// JavaScript and TypeScript allow among imports.
+func cHeader(lines []string, i int) int {
+	line := strings.TrimSpace(lines[i])
+	switch {
+	case line == "", strings.HasPrefix(line, "//"):
+		return i + 1
+	case strings.HasPrefix(line, "/*"):
+		return blockEnd(lines, i, "/*", "*/")
+	}
+	return -1
+}
+
+// goHeader recognizes comments and the package clause. Build constraints
+// and cgo preambles are comments.
+func goHeader(lines []string, i int) int {
+	if strings.HasPrefix(lines[i], "package ") {
+		return i + 1
+	}
+	return cHeader(lines, i)
+}
+
+// goImport recognizes single imports and import blocks.
+func goImport(lines []string, i int) int {
+	line := lines[i]
+	switch {
+	case strings.HasPrefix(line, "import ("):
+		for j := i + 1; j < len(lines); j++ {
+			if strings.TrimSpace(lines[j]) == ")" {
+				return j + 1
+			}
+		}
+		return -1
+	case strings.HasPrefix(line, "import "):
+		return i + 1
+	}
+	return -1
+}
+
+// pythonImport recognizes import and from ... import statements, including
+// parenthesized and backslash-continued ones.
+func pythonImport(lines []string, i int) int {
+	line := lines[i]
+	if !strings.HasPrefix(line, "import ") && !(strings.HasPrefix(line, "from ") && strings.Contains(line, " import ")) {
+		return -1
+	}
+
+	if strings.Contains(line, "(") && !strings.Contains(line, ")") {
+		for j := i + 1; j < len(lines); j++ {
+			if strings.Contains(lines[j], ")") {
+				return j + 1
+			}
+		}
+		return -1
+	}
+
+	j := i
+	for strings.HasSuffix(strings.TrimRight(lines[j], " \t\r"), "\\") {
+		j++
+		if j == len(lines) {
+			return -1
+		}
+	}
+	return j + 1
+}
+
+// pythonDocstring matches the start of a triple-quoted string literal,
+// with an optional prefix such as r or u.
+var pythonDocstring = regexp.MustCompile(`^[rRuUbBfF]{0,2}("""|\'\'\')`)
+
+// pythonHeader recognizes blank lines, # comments and docstrings.
+func pythonHeader(lines []string, i int) int {
+	line := strings.TrimSpace(lines[i])
+	if line == "" || strings.HasPrefix(line, "#") {
+		return i + 1
+	}
+	if m := pythonDocstring.FindStringSubmatch(line); m != nil {
+		return blockEnd(lines, i, m[1], m[1])
+	}
+	return -1
+}
+
+// jsImportEnd matches the module specifier that ends an import statement.
+var jsImportEnd = regexp.MustCompile(`(\bfrom\s*|^import\s*)['"][^'"]+['"]`)
+
+// jsMaxImportLines bounds how far a multi-line import is followed before
+// it is left alone.
+const jsMaxImportLines = 50
+
+// jsImport recognizes static import statements. Dynamic import() calls and
+// import.meta are expressions and are kept.
+func jsImport(lines []string, i int) int {
+	line := lines[i]
+	if !strings.HasPrefix(line, "import ") && !strings.HasPrefix(line, "import{") && !strings.HasPrefix(line, "import'") && !strings.HasPrefix(line, `import"`) {
+		return -1
+	}
+
+	for j := i; j < len(lines) && j < i+jsMaxImportLines; j++ {
+		if jsImportEnd.MatchString(lines[j]) {
+			return j + 1
+		}
+	}
+	return -1
+}
+
+// jsDirective matches directive prologues such as "use strict".
+var jsDirective = regexp.MustCompile(`^['"]use [a-z ]+['"];?$`)
+
+// jsHeader recognizes comments, a #! line and directives such as
+// "use strict" or "use client".
+func jsHeader(lines []string, i int) int {
+	line := strings.TrimSpace(lines[i])
+	if (i == 0 && strings.HasPrefix(line, "#!")) || jsDirective.MatchString(line) {
+		return i + 1
+	}
+	return cHeader(lines, i)
+}
@@ -0,0 +1,50 @@
+package flatten
+
+import "testing"
+
+func TestStripImports(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"main.go",
+			"package main\n\nimport \"fmt\"\n\nfunc main() {}\n",
+			"package main\n\nfunc main() {}\n"},
+		{"main.go",
+			"// Package main.\npackage main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n\nfunc main() {}\n",
+			"// Package main.\npackage main\n\nfunc main() {}\n"},
+		{"main.go",
+			"package main\n\n/*\n#include <stdio.h>\n*/\nimport \"C\"\n\nfunc main() {}\n",
+			"package main\n\n/*\n#include <stdio.h>\n*/\n\nfunc main() {}\n"},
+		// A raw string below the imports is code.
+		{"main.go",
+			"package main\n\nimport \"fmt\"\n\nvar src = `\nimport \"os\"\n`\n",
+			"package main\n\nvar src = `\nimport \"os\"\n`\n"},
+
+		{"app.py",
+			"#!/usr/bin/env python\n\"\"\"Docs.\n\nimport nothing\n\"\"\"\nimport os\nfrom a import (\n    b,\n)\n\nx = 1\n",
+			"#!/usr/bin/env python\n\"\"\"Docs.\n\nimport nothing\n\"\"\"\n\nx = 1\n"},
+		// Docstrings and code below the imports are kept.
+		{"app.py",
+			"import os\n\ndef f():\n    \"\"\"\nimport sys\n\"\"\"\n\nimport late\n",
+			"def f():\n    \"\"\"\nimport sys\n\"\"\"\n\nimport late\n"},
+
+		{"app.ts",
+			"'use strict';\n// header\nimport a from 'a';\nimport {\n  b,\n} from \"b\";\n\nexport const x = 1;\n",
+			"'use strict';\n// header\n\nexport const x = 1;\n"},
+		// Template literals below the imports are kept.
+		{"app.js",
+			"import a from 'a';\n\nconst t = `\nimport b from 'b';\n`;\n",
+			"const t = `\nimport b from 'b';\n`;\n"},
+		{"app.js",
+			"const x = await import('x');\n",
+			"const x = await import('x');\n"},
+
+		{"notes.txt", "import os\n", "import os\n"},
+	}
+
+	for _, tt := range tests {
+		if got := stripImports(tt.name, tt.in); got != tt.want {
+			t.Errorf("stripImports(%q, %q) =\n%q\nwant\n%q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
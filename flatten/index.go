@@ -0,0 +1,86 @@
+package flatten
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path/filepath"
+)
+
+// indexEntry is a link in the -index-html page: the original path of a
+// file and where it was written, relative to the destination folder.
+type indexEntry struct {
+	Path string
+	Href string
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Repo}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2rem auto; max-width: 60rem; padding: 0 1rem; color: #222; }
+h1 { font-size: 1.25rem; word-break: break-all; }
+ul { list-style: none; padding: 0; }
+li { padding: 0.15rem 0; font-family: ui-monospace, monospace; font-size: 0.9rem; }
+a { color: #0550ae; text-decoration: none; }
+a:hover { text-decoration: underline; }
+</style>
+</head>
+<body>
+<h1>{{.Repo}}</h1>
+<p>{{len .Files}} file(s)</p>
+<ul>
+{{- range .Files}}
+<li><a href="{{.Href}}">{{.Path}}</a></li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+// indexFileName is the name of the -index-html page. If a flattened file
+// already has that name, the page is written as fallbackIndexFileName.
+const (
+	indexFileName         = "index.html"
+	fallbackIndexFileName = "_index.html"
+)
+
+// writeIndexHTML writes a self-contained page to the destination folder
+// that links to every written file, so the folder can be browsed without
+// a server.
+func writeIndexHTML(entries []indexEntry, opts *Options) error {
+	var buf bytes.Buffer
+	err := indexTemplate.Execute(&buf, struct {
+		Repo  string
+		Files []indexEntry
+	}{opts.RepoURL, entries})
+	if err != nil {
+		return fmt.Errorf("error rendering index: %w", err)
+	}
+
+	name := indexFileName
+	for _, entry := range entries {
+		if entry.Href == indexFileName {
+			name = fallbackIndexFileName
+			warnf("A flattened file is named %s, so the index was written to %s\n", indexFileName, name)
+			break
+		}
+	}
+
+	err = writeOutput(filepath.Join(opts.DestFolder, name), buf.Bytes(), opts)
+	if err != nil {
+		return fmt.Errorf("error writing index: %w", err)
+	}
+	return nil
+}
+
+// relativeHref returns the link to target from the destination folder.
+func relativeHref(dest, target string) string {
+	rel, err := filepath.Rel(dest, target)
+	if err != nil {
+		return filepath.ToSlash(target)
+	}
+	return filepath.ToSlash(rel)
+}
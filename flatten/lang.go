@@ -0,0 +1,185 @@
+package flatten
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// languages maps file extensions to the language identifiers used to
+// label source blocks in document formats.
+var languages = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".js":    "javascript",
+	".mjs":   "javascript",
+	".cjs":   "javascript",
+	".jsx":   "jsx",
+	".ts":    "typescript",
+	".tsx":   "tsx",
+	".java":  "java",
+	".kt":    "kotlin",
+	".scala": "scala",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".cxx":   "cpp",
+	".hpp":   "cpp",
+	".cs":    "csharp",
+	".rs":    "rust",
+	".rb":    "ruby",
+	".php":   "php",
+	".swift": "swift",
+	".m":     "objc",
+	".lua":   "lua",
+	".pl":    "perl",
+	".r":     "r",
+	".sh":    "sh",
+	".bash":  "bash",
+	".zsh":   "zsh",
+	".ps1":   "powershell",
+	".sql":   "sql",
+	".html":  "html",
+	".htm":   "html",
+	".css":   "css",
+	".scss":  "scss",
+	".xml":   "xml",
+	".json":  "json",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".toml":  "toml",
+	".ini":   "ini",
+	".md":    "markdown",
+	".proto": "protobuf",
+	".el":    "emacs-lisp",
+	".clj":   "clojure",
+	".hs":    "haskell",
+	".ex":    "elixir",
+	".exs":   "elixir",
+	".erl":   "erlang",
+	".vim":   "vim",
+	".tf":    "hcl",
+	".dart":  "dart",
+}
+
+// fileLanguages maps well-known file names without a telling extension.
+var fileLanguages = map[string]string{
+	"Makefile":   "makefile",
+	"Dockerfile": "dockerfile",
+	"go.mod":     "go-mod",
+}
+
+// language returns the language identifier for a file, or "" when it is
+// not known.
+func language(name string) string {
+	base := path.Base(name)
+	if lang, ok := fileLanguages[base]; ok {
+		return lang
+	}
+	return languages[strings.ToLower(path.Ext(base))]
+}
+
+// languageNames are the display names of language identifiers whose name
+// is not just the identifier capitalized.
+var languageNames = map[string]string{
+	"javascript": "JavaScript",
+	"typescript": "TypeScript",
+	"jsx":        "JSX",
+	"tsx":        "TSX",
+	"cpp":        "C++",
+	"csharp":     "C#",
+	"php":        "PHP",
+	"objc":       "Objective-C",
+	"sh":         "Shell",
+	"powershell": "PowerShell",
+	"sql":        "SQL",
+	"html":       "HTML",
+	"css":        "CSS",
+	"scss":       "SCSS",
+	"xml":        "XML",
+	"json":       "JSON",
+	"yaml":       "YAML",
+	"toml":       "TOML",
+	"ini":        "INI",
+	"protobuf":   "Protocol Buffers",
+	"emacs-lisp": "Emacs Lisp",
+	"hcl":        "HCL",
+	"go-mod":     "Go",
+}
+
+// otherLanguage is the group of files with no known language.
+const otherLanguage = "Other"
+
+// languageName returns the display name of the language of a file, such
+// as "Go" or "TypeScript", or otherLanguage when it is not known.
+func languageName(name string) string {
+	lang := language(name)
+	if lang == "" {
+		return otherLanguage
+	}
+	if display, ok := languageNames[lang]; ok {
+		return display
+	}
+	return strings.ToUpper(lang[:1]) + lang[1:]
+}
+
+// sortByLanguage orders entries by language name, with otherLanguage
+// last, keeping the order of files within a language.
+func sortByLanguage(entries []tocEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := languageName(entries[i].name), languageName(entries[j].name)
+		if (a == otherLanguage) != (b == otherLanguage) {
+			return b == otherLanguage
+		}
+		return a < b
+	})
+}
+
+// parseLangMap parses -lang-map entries of the form ".ext=language".
+func parseLangMap(value string) (map[string]string, error) {
+	langMap := make(map[string]string)
+	for _, entry := range splitList(value) {
+		ext, lang, ok := strings.Cut(entry, "=")
+		ext, lang = strings.TrimSpace(ext), strings.TrimSpace(lang)
+		if !ok || ext == "" || lang == "" {
+			return nil, fmt.Errorf("invalid -lang-map entry %q, expected .ext=language", entry)
+		}
+		langMap[ext] = lang
+	}
+	return langMap, nil
+}
+
+// mapLanguages merges extension overrides into languages. Extensions are
+// matched case-insensitively, with or without the leading dot.
+func mapLanguages(langMap map[string]string) {
+	for ext, lang := range langMap {
+		languages["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = lang
+	}
+}
+
+// syntaxExt returns the extension whose syntax language-aware transforms
+// use for a file: the first extension, in sorted order, of the file's
+// language for which known is true. A file mapped to another language
+// with -lang-map is thus treated like that language's files. Files of no
+// known language keep their own extension, and files of a language that
+// has no such extension get "".
+func syntaxExt(name string, known func(ext string) bool) string {
+	lang := language(name)
+	if lang == "" {
+		return strings.ToLower(path.Ext(name))
+	}
+
+	var exts []string
+	for ext, l := range languages {
+		if l == lang && known(ext) {
+			exts = append(exts, ext)
+		}
+	}
+	if len(exts) == 0 {
+		return ""
+	}
+	sort.Strings(exts)
+	return exts[0]
+}
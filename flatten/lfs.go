@@ -0,0 +1,168 @@
+package flatten
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// lfsPointerPrefix starts the content of every Git LFS pointer file.
+const lfsPointerPrefix = "version https://git-lfs.github.com/spec/v1\n"
+
+// lfsPointerMaxSize is the size above which a file is never taken for a
+// pointer; real pointers are around 130 bytes.
+const lfsPointerMaxSize = 1024
+
+// lfsPointer is the object a Git LFS pointer file refers to.
+type lfsPointer struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// parseLFSPointer returns the object content points to, if it is a Git LFS
+// pointer file.
+func parseLFSPointer(content string) (lfsPointer, bool) {
+	if len(content) > lfsPointerMaxSize || !strings.HasPrefix(content, lfsPointerPrefix) {
+		return lfsPointer{}, false
+	}
+
+	var p lfsPointer
+	for _, line := range strings.Split(content, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "oid":
+			p.OID = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			p.Size, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	return p, p.OID != ""
+}
+
+// lfsEndpoint returns the Git LFS API endpoint of a repository, which
+// lives next to its HTTPS URL.
+func lfsEndpoint(repoURL string) (string, error) {
+	httpURL := strings.TrimSuffix(repoURL, "/")
+	if !strings.HasPrefix(httpURL, "https://") && !strings.HasPrefix(httpURL, "http://") {
+		var err error
+		httpURL, err = rewriteProtocol(repoURL, "https")
+		if err != nil || !strings.HasPrefix(httpURL, "https://") {
+			return "", fmt.Errorf("cannot fetch Git LFS objects for %s, which has no HTTP(S) URL", repoURL)
+		}
+	}
+	if !strings.HasSuffix(httpURL, ".git") {
+		httpURL += ".git"
+	}
+	return httpURL + "/info/lfs", nil
+}
+
+// fetchLFSObject downloads the object a pointer refers to through the
+// batch API of the Git LFS server.
+func fetchLFSObject(ctx context.Context, opts *Options, p lfsPointer) (string, error) {
+	endpoint, err := lfsEndpoint(opts.RepoURL)
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{Transport: httpRoundTripper(opts)}
+
+	body, err := json.Marshal(map[string]any{
+		"operation": "download",
+		"transfers": []string{"basic"},
+		"objects":   []lfsPointer{p},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.git-lfs+json")
+	req.Header.Set("Content-Type", "application/vnd.git-lfs+json")
+	setLFSAuth(req, opts)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error requesting LFS object %s: %w", p.OID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error requesting LFS object %s: %s", p.OID, resp.Status)
+	}
+
+	var batch struct {
+		Objects []struct {
+			Actions struct {
+				Download struct {
+					Href   string            `json:"href"`
+					Header map[string]string `json:"header"`
+				} `json:"download"`
+			} `json:"actions"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"objects"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&batch)
+	if err != nil {
+		return "", fmt.Errorf("error decoding LFS response: %w", err)
+	}
+	if len(batch.Objects) == 0 {
+		return "", fmt.Errorf("LFS server returned no object for %s", p.OID)
+	}
+	object := batch.Objects[0]
+	if object.Error != nil {
+		return "", fmt.Errorf("error requesting LFS object %s: %s", p.OID, object.Error.Message)
+	}
+
+	batchHost := req.URL.Host
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, object.Actions.Download.Href, nil)
+	if err != nil {
+		return "", err
+	}
+	for key, value := range object.Actions.Download.Header {
+		req.Header.Set(key, value)
+	}
+	// Downloads from the LFS server itself take the same credentials;
+	// other hosts, such as storage buckets, authorize with the header the
+	// batch response gave and must not see them.
+	if req.Header.Get("Authorization") == "" && req.URL.Host == batchHost {
+		setLFSAuth(req, opts)
+	}
+
+	resp, err = client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error downloading LFS object %s: %w", p.OID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error downloading LFS object %s: %s", p.OID, resp.Status)
+	}
+
+	// Reading one byte past the size in the pointer catches servers that
+	// send more without reading an unbounded body.
+	data, err := io.ReadAll(io.LimitReader(resp.Body, p.Size+1))
+	if err != nil {
+		return "", fmt.Errorf("error downloading LFS object %s: %w", p.OID, err)
+	}
+	if int64(len(data)) != p.Size {
+		return "", fmt.Errorf("error downloading LFS object %s: got %d bytes, pointer says %d", p.OID, len(data), p.Size)
+	}
+	return string(data), nil
+}
+
+// setLFSAuth adds the credentials entered at the prompt, if any, to a
+// request to the LFS server.
+func setLFSAuth(req *http.Request, opts *Options) {
+	if auth, ok := opts.Auth.(githttp.AuthMethod); ok {
+		auth.SetAuth(req)
+	}
+}
@@ -0,0 +1,65 @@
+package flatten
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+func TestFetchLFSObject(t *testing.T) {
+	const object = "large file content\n"
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "alice" || pass != "s3cret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/repo.git/info/lfs/objects/batch":
+			json.NewEncoder(w).Encode(map[string]any{
+				"objects": []any{map[string]any{
+					"actions": map[string]any{
+						"download": map[string]any{"href": srv.URL + "/objects/1"},
+					},
+				}},
+			})
+		case "/objects/1":
+			w.Write([]byte(object))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	auth := &githttp.BasicAuth{Username: "alice", Password: "s3cret"}
+	tests := []struct {
+		size    int64
+		auth    bool
+		wantErr bool
+	}{
+		{int64(len(object)), true, false},
+		{int64(len(object)), false, true},
+		{int64(len(object)) - 1, true, true},
+		{int64(len(object)) + 1, true, true},
+	}
+
+	for _, tt := range tests {
+		opts := &Options{RepoURL: srv.URL + "/repo"}
+		if tt.auth {
+			opts.Auth = auth
+		}
+		got, err := fetchLFSObject(context.Background(), opts, lfsPointer{OID: "1", Size: tt.size})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("size %d, auth %v: error = %v, wantErr %v", tt.size, tt.auth, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != object {
+			t.Errorf("size %d, auth %v: content %q, want %q", tt.size, tt.auth, got, object)
+		}
+	}
+}
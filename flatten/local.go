@@ -0,0 +1,36 @@
+package flatten
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// isLocalRepo reports whether -repo names a directory on this machine
+// rather than a URL. Local repositories are opened in place instead of
+// being cloned.
+func isLocalRepo(repoURL string) bool {
+	if strings.Contains(repoURL, "://") || scpURL.MatchString(repoURL) {
+		return false
+	}
+	info, err := os.Stat(repoURL)
+	return err == nil && info.IsDir()
+}
+
+// openLocalRepo opens the local repository named by -repo.
+func openLocalRepo(opts *Options) (*git.Repository, error) {
+	log := opts.log()
+	start := time.Now()
+
+	repo, err := git.PlainOpen(opts.RepoURL)
+	if err != nil {
+		log.Error("open failed", "path", opts.RepoURL, "error", err)
+		return nil, fmt.Errorf("error opening repository: %w", err)
+	}
+
+	log.Info("repository opened", "path", opts.RepoURL, "duration", time.Since(start))
+	return repo, nil
+}
@@ -0,0 +1,1711 @@
+package flatten
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Options configure a run. The command fills them from its flags; callers
+// of FlattenTo and FlattenRepo set the ones they need, and zero values
+// disable the corresponding option.
+type Options struct {
+	RepoURL     string
+	DestFolder  string
+	ExcludeDirs []string
+	Include     string
+	Extensions  []string
+	SingleFile  bool
+	MaxSize     int64
+	MaxFiles    int
+	Comment     string
+	OutPerDir   bool
+	// PerTopLevel groups OutPerDir output by top-level directory instead
+	// of by the directory of each file.
+	PerTopLevel bool
+	// TopLevelIndex writes an index of the PerTopLevel output files.
+	TopLevelIndex bool
+	Redact        bool
+	Subpath       string
+	Format        string
+	Pretty        bool
+	// BinaryBase64 writes files that are not valid UTF-8 base64-encoded
+	// in JSON output, untouched by transforms.
+	BinaryBase64 bool
+	// WithContent adds the file content as a last column to CSV output.
+	WithContent bool
+	// NormalizeUnicode is the normalization form text content is brought
+	// into, or nil to leave it as it is.
+	NormalizeUnicode *norm.Form
+	// FilterCmd is the -filter-cmd command and its arguments, run for the
+	// files with one of FilterExts, or all files when it is empty.
+	FilterCmd     []string
+	FilterExts    []string
+	FilterTimeout time.Duration
+
+	SubmoduleContents bool
+	AddedSince        string
+	ChangedSince      string
+	MergeBase         string
+	HunksOnly         bool
+	RespectGitignore  bool
+	Template          *template.Template
+	Dedent            bool
+	Bare              bool
+	RelativeTo        string
+	Jobs              int
+	Zip               string
+	Ref               string
+	// Refs are all the -ref values; with more than one, each is
+	// flattened into its own section, with Ref set to it.
+	Refs []string
+	// DetectDefaultBranch asks the remote for its default branch before
+	// cloning without a -ref; DefaultBranch is the branch it reported.
+	DetectDefaultBranch bool
+	DefaultBranch       plumbing.ReferenceName
+	// Auth holds the credentials entered at the prompt after the server
+	// asked for them; NoPrompt fails instead of asking.
+	Auth     transport.AuthMethod
+	NoPrompt bool
+	// Repos are the options of every -repo when several are bundled
+	// into one output, at most CloneConcurrency of them cloned at once.
+	Repos            []*Options
+	CloneConcurrency int
+	CacheDir         string
+	// Mirror clones remote repositories with all their refs into
+	// MirrorDir, a temporary directory removed after the run unless
+	// KeepClone is set.
+	Mirror          bool
+	MirrorDir       string
+	KeepClone       bool
+	Minify          bool
+	ContinueOnError bool
+	Checksums       bool
+	TOC             bool
+	Trailing        string
+	Pins            []string
+	PinReadme       bool
+	Quiet           bool
+	Stdout          bool
+	// Webhook is the URL the single-file output is POSTed to instead of
+	// being written, with up to WebhookRetries retries.
+	Webhook        string
+	WebhookRetries int
+	DestMode       os.FileMode
+	FileMode       os.FileMode
+	// ModeFromTree gives flattened files the mode of their tree entry,
+	// 0755 for executables and 0644 otherwise, instead of FileMode.
+	ModeFromTree bool
+	// PathComments starts every flattened file with a comment naming its
+	// repository path, in files whose language has comments.
+	PathComments bool
+	FileList     []string
+	// FileListSource names where FileList came from in warnings: the
+	// "file list" of -filelist or the "diff" of -diff.
+	FileListSource    string
+	Wrap              int
+	LengthPrefix      bool
+	MaxLineLength     int
+	Collapsible       bool
+	Traversal         string
+	Sort              string
+	BlameSummary      bool
+	PreserveStructure bool
+	KeepEmptyDirs     bool
+	HeaderPosition    string
+	MaxCloneSize      int64
+	RateLimit         int64
+	Throttle          *throttle
+	StripImports      bool
+	SplitBytes        int64
+	WithCommitMessage bool
+	Gzip              bool
+	SinceDays         int
+	RecencySince      time.Time
+	HTTPHeaders       http.Header
+	Local             bool
+	IncludeWorktree   bool
+	BOM               bool
+	Archive           bool
+	SkipLFS           bool
+	SkipHidden        bool
+	ExcludeGenerated  bool
+	GroupByLanguage   bool
+	ResolveSymlinks   bool
+	SqueezeBlank      bool
+	StripBlank        bool
+	TokensPerFile     string
+	IndexHTML         bool
+	MaxTreeFiles      int
+	Force             bool
+	// RootCAs are the certificates trusted for HTTPS, when -ca-bundle
+	// adds to the system ones.
+	RootCAs *x509.CertPool
+	// SourceHash, when set, receives every flattened file for
+	// -print-source-hash. HashOnly runs without writing any output.
+	SourceHash hash.Hash
+	HashOnly   bool
+	// ListFiles prints the paths of the selected files instead of
+	// flattening them, without reading any file.
+	ListFiles bool
+	// TreeJSON writes the tree entries of the selected files as JSON
+	// instead of flattening them, again without reading any file.
+	TreeJSON          bool
+	FetchLFS          bool
+	CollisionStrategy string
+	ContentTypes      []string
+	ReportLargest     int
+	Transforms        map[string][]string
+	TOCStats          bool
+
+	// Rewrites are applied in order to the paths shown in the output.
+	Rewrites []rewriteRule
+
+	// Ranges limits the named files to the given line ranges; other files
+	// are written whole.
+	Ranges map[string][]lineRange
+
+	// Logger receives structured entries about the run. It is independent
+	// of the messages printed to the console.
+	Logger *slog.Logger
+
+	// repo is the repository FlattenRepo was given, read instead of
+	// cloning RepoURL.
+	repo *git.Repository
+}
+
+// discardLogger drops every entry. It is used when no log file is set.
+var discardLogger = slog.New(slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+
+func (o *Options) log() *slog.Logger {
+	if o.Logger == nil {
+		return discardLogger
+	}
+	return o.Logger
+}
+
+// pathsOnly reports whether the run only reports which files are selected,
+// so their contents are never read.
+func (o *Options) pathsOnly() bool {
+	return o.ListFiles || o.TreeJSON
+}
+
+// concatenated reports whether files are combined into shared output files
+// rather than written one by one.
+func (o *Options) concatenated() bool {
+	return o.SingleFile || o.OutPerDir
+}
+
+// Main runs the gitflat command with the flags in os.Args, and exits with a
+// non-zero status when it fails.
+func Main() {
+	var repos listFlag
+	flag.Var(&repos, "repo", "URL of the Git repository; repeat with -single to bundle several repositories")
+	cloneConcurrency := flag.Int("clone-concurrency", 4, "Number of repositories cloned at the same time when -repo is repeated")
+	destFolder := flag.String("dest", "", "Destination folder for flattened files")
+	excludeDirs := flag.String("exclude", "", "Comma-separated list of directories to exclude")
+	include := flag.String("include", "", "Only include files from this directory")
+	excludeGenerated := flag.Bool("exclude-generated", false, "Skip generated files, such as *.pb.go or files with a \"DO NOT EDIT\" header")
+	skipHidden := flag.Bool("skip-hidden", false, "Skip dotfiles and the files of dot-directories (below the -include directory, when set)")
+	sortOrder := flag.String("sort", "", "Experimental: order files by go-deps, Go packages after the packages of the repository they import")
+	traversal := flag.String("traversal", "dfs", "Order in which files are written: dfs (tree order) or bfs (shallower files first)")
+	var refs listFlag
+	flag.Var(&refs, "ref", "Branch, tag or commit to flatten instead of HEAD; repeat with -single to flatten each into its own labeled section")
+	noPrompt := flag.Bool("no-prompt", false, "Fail when an HTTP(S) clone needs credentials instead of asking for them on the terminal")
+	detectDefault := flag.Bool("detect-default-branch", false, "Without -ref, ask the remote for its default branch and clone that instead of relying on go-git's choice")
+	pr := flag.Int("pr", 0, "Pull request number to flatten; fetches refs/pull/N/head, or refs/merge-requests/N/head on GitLab (-ref takes precedence)")
+	subpath := flag.String("subpath", "", "Only check out and process this directory of a monorepo")
+	exts := flag.String("exts", "", "Comma-separated list of file extensions to include (e.g., .go,.txt)")
+	contentTypes := flag.String("content-type", "", "Comma-separated list of detected content types to include (e.g., text/*,application/json)")
+	extsGroup := flag.String("exts-group", "", "Comma-separated list of extension groups to include (code, docs, config, web)")
+	respectGitignore := flag.Bool("respect-gitignore", false, "Skip files matched by the repository's .gitignore files, and by .git/info/exclude for a local -repo")
+	diffInput := flag.String("diff", "", "Only include the files changed by the unified diff in this file (- for stdin), such as the output of git diff")
+	fileList := flag.String("filelist", "", "Only include the files listed in this file, one path per line")
+	configPath := flag.String("config", "", "Path to a JSON config file")
+	singleFile := flag.Bool("single", false, "Flatten the repo into a single text file")
+	maxSize := flag.Int64("max-size", 0, "Skip files larger than this many bytes (0 for no limit)")
+	maxLineLength := flag.Int("max-line-length", 0, "Skip files with a line longer than this many characters, such as minified files (0 for no limit)")
+	maxTreeFiles := flag.Int("max-tree-files", 0, "Abort before reading any file when the tree has more than this many files (0 for no limit)")
+	force := flag.Bool("force", false, "Process the tree even when it has more files than -max-tree-files")
+	maxFiles := flag.Int("max-files", 0, "Stop after this many files have been included (0 for no limit)")
+	indexHTML := flag.Bool("index-html", false, "Also write an index.html to the destination folder linking to every flattened file")
+	collisionStrategy := flag.String("collision-strategy", "overwrite", "How files with the same base name are named in flat output: overwrite, suffix, path or hash")
+	preserveStructure := flag.Bool("preserve-structure", false, "Write files at their repository paths instead of flattening them")
+	keepEmptyDirs := flag.Bool("keep-empty-dirs", false, "With -preserve-structure, keep directories left without any included files")
+	var httpHeaders listFlag
+	flag.Var(&httpHeaders, "http-header", "Send this header with HTTP(S) clone requests, as 'Key: Value' (repeatable)")
+	caBundle := flag.String("ca-bundle", "", "PEM file of CA certificates to trust for HTTPS, in addition to the system ones")
+	rateLimit := flag.Int64("rate-limit", 0, "Fetch over HTTP(S) at no more than this many bytes per second (0 for no limit)")
+	maxCloneSize := flag.Int64("max-clone-size", 0, "Abort the clone once more than this many bytes have been fetched over HTTP(S) (0 for no limit)")
+	skipLFS := flag.Bool("skip-lfs", true, "Skip Git LFS pointer files")
+	fetchLFS := flag.Bool("fetch-lfs", false, "Download the objects of Git LFS pointer files from the LFS server and include those instead")
+	archive := flag.Bool("archive", false, "Treat -repo as a .tar.gz or .zip archive to download and flatten instead of a Git repository (implied by a .tar.gz, .tgz or .zip suffix)")
+	includeWorktree := flag.Bool("include-worktree", false, "Read files from the working directory of a local -repo, including uncommitted changes")
+	resolveSymlinks := flag.Bool("resolve-symlinks", false, "For a local -repo, include the content of the file a symlink points to instead of the link target, for links within the repository")
+	bare := flag.Bool("bare", false, "Read files straight from an in-memory clone instead of checking out a working tree into the destination")
+	splitBytes := flag.Int64("split-bytes", 0, "Split single-file output into numbered files of at most this many bytes, at file boundaries (0 to disable)")
+	splitByTopLevel := flag.Bool("split-by-toplevel", false, "Write one file per top-level directory, as -per-toplevel does, plus an index listing each with its file count and size")
+	perTopLevel := flag.Bool("per-toplevel", false, "Concatenate the files under each top-level directory into one file per directory, with root files in root.txt (implies -out-per-dir)")
+	outPerDir := flag.Bool("out-per-dir", false, "Concatenate the files of each source directory into one file per directory")
+	dedentFiles := flag.Bool("dedent", false, "Strip the indentation shared by all lines of each file in single-file and per-directory output")
+	wrapWidth := flag.Int("wrap", 0, "Hard-wrap lines longer than this many characters in single-file and per-directory output (0 to disable)")
+	stripImportBlocks := flag.Bool("strip-imports", false, "Experimental: remove import statements from Go, Python, JavaScript and TypeScript files")
+	squeezeBlankLines := flag.Bool("squeeze-blank", false, "Collapse runs of blank lines in each file into one, like cat -s")
+	stripBlankLines := flag.Bool("strip-blank", false, "Remove all blank lines from each file")
+	minifyFiles := flag.Bool("minify", false, "Remove insignificant whitespace from JSON, JavaScript and CSS files")
+	redactSecrets := flag.Bool("redact", false, "Replace likely secrets (keys, tokens, passwords) with [REDACTED]")
+	withCommitMessage := flag.Bool("with-commit-message", false, "Start single-file output with the message, author and date of the flattened commit")
+	blame := flag.Bool("blame-summary", false, "Start each file in single-file output with the hash, author and date of the last commit that touched it")
+	submoduleContents := flag.Bool("submodule-contents", false, "Also include the files of submodules, prefixed with the submodule path")
+	addedSince := flag.String("added-since", "", "Only include files added since this ref (branch, tag or commit)")
+	mergeBaseRef := flag.String("merge-base", "", "Only include files changed since the merge base of -ref (or HEAD) and this ref, like git diff ref...HEAD")
+	changedSinceRef := flag.String("changed-since", "", "Only include files added or modified since this ref (branch, tag or commit)")
+	hunksOnly := flag.Bool("hunks-only", false, "With -changed-since or -merge-base, and -single, write only the changed hunks of each file instead of the whole file")
+	sinceDays := flag.Int("since-days", 0, "Only include files last changed within this many days (0 for no limit)")
+	recencySince := flag.String("recency-since", "", "Only include files last changed on or after this date (2006-01-02 or RFC 3339)")
+	relativeTo := flag.String("relative-to", "", "Show paths in headers relative to this directory")
+	langMapFlag := flag.String("lang-map", "", "Comma-separated extension=language overrides for code fences and language-aware transforms (e.g., .h=cpp,.m=objc)")
+	groupByLanguage := flag.Bool("group-by-language", false, "With -single and -format markdown, group files under a heading per language")
+	templatePath := flag.String("template", "", "With -single, render the output with this Go text/template file instead of -format")
+	format := flag.String("format", "plain", "Output format for single-file and per-directory output (plain, json, jsonl, csv, org or markdown)")
+	bom := flag.Bool("bom", false, "Start single-file output with a UTF-8 byte order mark, for Windows tools that expect one")
+	gzipOutput := flag.Bool("gzip", false, "Compress single-file output with gzip")
+	headerPosition := flag.String("header-position", "top", "Where file paths go in plain and markdown output: top, bottom or both")
+	collapsible := flag.Bool("collapsible", false, "Wrap each file in a collapsible <details> block in markdown output")
+	filterCmd := flag.String("filter-cmd", "", "Pipe each file's content through this command (run without a shell) and use its output instead, like a Git clean filter")
+	filterExts := flag.String("filter-exts", "", "Comma-separated list of file extensions -filter-cmd applies to (default all files)")
+	filterTimeout := flag.Duration("filter-timeout", 30*time.Second, "Fail a file when -filter-cmd runs longer than this for it (0 for no limit)")
+	normalizeUnicode := flag.String("normalize-unicode", "", "Bring text content into this Unicode normalization form: nfc or nfd (default off)")
+	binaryBase64 := flag.Bool("binary-base64", false, "With -format json or jsonl, write binary files base64-encoded with \"encoding\":\"base64\" so they round-trip")
+	withContent := flag.Bool("with-content", false, "With -format csv, add the file content as a last column")
+	pretty := flag.Bool("pretty", false, "Indent JSON output for readability")
+	commentStyle := flag.String("comment-style", "", "Prefix single-file separators with a line comment marker (//, #, ; or --)")
+	var rewrites listFlag
+	flag.Var(&rewrites, "rewrite", "Show paths under a directory as if they were under another, as from=to (repeatable)")
+	var ranges listFlag
+	flag.Var(&ranges, "ranges", "Only include these lines of a file in single-file output, as path:start-end (repeatable)")
+	var pins listFlag
+	flag.Var(&pins, "pin", "Always include this file and write it before all others (repeatable)")
+	pinReadme := flag.Bool("pin-readme", false, "Always include the top-level README and LICENSE files and write them first")
+	continueOnError := flag.Bool("continue-on-error", false, "Report files that cannot be read or written and carry on, failing at the end")
+	jobs := flag.Int("jobs", runtime.NumCPU(), "Number of files transformed in parallel")
+	logFile := flag.String("log-file", "", "Write structured JSON log entries for the run to this file")
+	cacheDir := flag.String("cache-dir", os.Getenv("GITFLAT_CACHE_DIR"), "Keep clones in this directory and fetch into them on later runs (defaults to $GITFLAT_CACHE_DIR)")
+	noCache := flag.Bool("no-cache", false, "Ignore -cache-dir and clone from scratch")
+	mirror := flag.Bool("mirror", false, "Mirror clone the repository with all its refs into a temporary directory, instead of -cache-dir, so several -ref values need no further fetches")
+	keepClone := flag.Bool("keep-clone", false, "With -mirror, keep the mirror clone instead of removing it after the run")
+	zipPath := flag.String("zip", "", "Write the flattened files to this zip archive instead of -dest (- for stdout)")
+	lengthPrefix := flag.Bool("length-prefix", false, "Include the content size in bytes in each plain separator so the output can be parsed unambiguously")
+	separatorTrailing := flag.String("separator-trailing", `\n\n`, "Text written after each file in plain output; Go escapes such as \\n and \\f are supported")
+	toc := flag.Bool("toc", false, "Start single-file output with a table of contents")
+	tocStats := flag.Bool("toc-stats", false, "Show the size and line count of each file in the table of contents")
+	tokensPerFile := flag.String("tokens-per-file", "", "Print the estimated token count of every included file to stderr, largest first, as text or json")
+	reportLargestFiles := flag.Int("report-largest", 0, "Print the sizes of this many of the largest included files to stderr")
+	checksums := flag.Bool("checksums", false, "Write a SHA256SUMS file listing the checksum of every output file")
+	protocol := flag.String("protocol", "", "Rewrite -repo to clone over this transport (ssh or https)")
+	treeJSONOnly := flag.Bool("tree-json", false, "Print the path, size, mode and blob hash of the files the filters select as JSON, without reading them, then exit")
+	listFilesOnly := flag.Bool("list-files", false, "Print the paths of the files the filters select, one per line, without reading them, then exit")
+	listRefsOnly := flag.Bool("list-refs", false, "Print the branches and tags of -repo without cloning it, then exit")
+	destModeFlag := flag.String("dest-mode", "", "Octal permission mode of the destination folder, e.g. 0700 (default 0755)")
+	pathComments := flag.Bool("path-comments", false, "Start each flattened file with a comment in its language naming its path in the repository")
+	modeFromTree := flag.Bool("mode-from-tree", false, "Give flattened files the mode of their tree entry: 0755 for executables, 0644 for others")
+	fileModeFlag := flag.String("file-mode", "", "Octal permission mode of the output files, e.g. 0600 (default 0644)")
+	quiet := flag.Bool("quiet", false, "Do not show progress or informational messages; warnings and errors are still printed")
+	noColor := flag.Bool("no-color", false, "Do not color warnings and errors, even on a terminal")
+	printSourceHash := flag.Bool("print-source-hash", false, "Print a SHA-256 hash of the paths and contents of the flattened files to stdout; without -dest, -zip or -compare nothing else is written")
+	compare := flag.String("compare", "", "Generate the output and compare it with this existing output file or folder instead of writing it; exits nonzero when they differ")
+	webhook := flag.String("webhook", "", "With -single, POST the output to this URL instead of writing a file in -dest")
+	webhookRetries := flag.Int("webhook-retries", 3, "Number of times a -webhook delivery is retried after a connection error or a 429 or 5xx response")
+	toStdout := flag.Bool("stdout", false, "With -single, write the output to stdout instead of a file in -dest")
+	expandEnv := flag.Bool("expand-env", false, "Expand $VAR and ${VAR} references in -repo, -dest and the other path flags")
+
+	flag.Parse()
+
+	messages.quiet = *quiet
+	messages.color = useColor(*noColor)
+
+	if *expandEnv {
+		for _, value := range []*string{destFolder, excludeDirs, include, subpath, exts, addedSince, changedSinceRef, mergeBaseRef, logFile, relativeTo, zipPath, configPath, cacheDir, fileList, diffInput, templatePath, caBundle, compare} {
+			*value = os.ExpandEnv(*value)
+		}
+		for i, repo := range repos {
+			repos[i] = os.ExpandEnv(repo)
+		}
+		for i, ref := range refs {
+			refs[i] = os.ExpandEnv(ref)
+		}
+		for i, header := range httpHeaders {
+			httpHeaders[i] = os.ExpandEnv(header)
+		}
+	}
+
+	for i, repo := range repos {
+		repos[i] = expandGist(repo)
+
+		if *protocol != "" {
+			rewritten, err := rewriteProtocol(repos[i], *protocol)
+			if err != nil {
+				errorf("%v\n", err)
+				usage()
+			}
+			repos[i] = rewritten
+		}
+	}
+
+	repoURL := ""
+	if len(repos) > 0 {
+		repoURL = repos[0]
+	}
+
+	if len(repos) > 1 && (!*singleFile || (*format != "plain" && *format != "markdown" && *format != "org") || *templatePath != "" || *splitBytes > 0 || *listRefsOnly || *includeWorktree) {
+		errorf("a repeated -repo requires -single with -format plain, markdown or org, and cannot be used with -template, -split-bytes, -list-refs or -include-worktree\n")
+		usage()
+	}
+
+	if *pr < 0 {
+		errorf("-pr must be a positive number\n")
+		usage()
+	}
+	if *pr > 0 {
+		switch {
+		case len(repos) > 1:
+			errorf("-pr cannot be used with a repeated -repo\n")
+			usage()
+		case len(refs) > 0:
+			warnf("-ref is set, ignoring -pr\n")
+		default:
+			refs = listFlag{pullRequestRef(repoURL, *pr)}
+		}
+	}
+
+	if *cloneConcurrency < 1 {
+		errorf("-clone-concurrency must be at least 1\n")
+		usage()
+	}
+
+	if repoURL == "" || (*destFolder == "" && !*listRefsOnly && *zipPath == "" && !*toStdout && *webhook == "" && *compare == "" && !*listFilesOnly && !*treeJSONOnly && !*printSourceHash) {
+		usage()
+	}
+
+	if *splitByTopLevel {
+		*perTopLevel = true
+	}
+	if *perTopLevel {
+		*outPerDir = true
+	}
+
+	if *zipPath != "" && (*singleFile || *outPerDir || *checksums) {
+		errorf("-zip cannot be used with -single, -out-per-dir or -checksums\n")
+		usage()
+	}
+
+	if *singleFile && *outPerDir {
+		errorf("-single and -out-per-dir cannot be used together\n")
+		usage()
+	}
+
+	switch *commentStyle {
+	case "", "//", "#", ";", "--":
+	default:
+		errorf("unsupported comment style %q\n", *commentStyle)
+		usage()
+	}
+
+	switch *format {
+	case "plain", "json", "jsonl", "csv", "org", "markdown":
+	default:
+		errorf("unsupported format %q\n", *format)
+		usage()
+	}
+
+	if *withContent && *format != "csv" {
+		errorf("-with-content requires -format csv\n")
+		usage()
+	}
+
+	switch *collisionStrategy {
+	case "overwrite", "suffix", "path", "hash":
+	default:
+		errorf("unsupported collision strategy %q\n", *collisionStrategy)
+		usage()
+	}
+
+	if *traversal != "dfs" && *traversal != "bfs" {
+		errorf("unsupported traversal %q\n", *traversal)
+		usage()
+	}
+
+	if *sortOrder != "" && *sortOrder != "go-deps" {
+		errorf("unsupported sort %q\n", *sortOrder)
+		usage()
+	}
+
+	if *sortOrder != "" && *traversal != "dfs" {
+		errorf("-sort cannot be used with -traversal bfs\n")
+		usage()
+	}
+
+	if *pretty && *format != "json" && !*treeJSONOnly {
+		errorf("-pretty can only be used with -format json or -tree-json\n")
+		usage()
+	}
+
+	var filterArgs []string
+	if *filterCmd != "" {
+		var err error
+		filterArgs, err = splitCommand(*filterCmd)
+		if err == nil {
+			_, err = exec.LookPath(filterArgs[0])
+		}
+		if err != nil {
+			errorf("invalid -filter-cmd: %v\n", err)
+			usage()
+		}
+	}
+
+	if *filterExts != "" && *filterCmd == "" {
+		errorf("-filter-exts requires -filter-cmd\n")
+		usage()
+	}
+
+	if *filterTimeout < 0 {
+		errorf("-filter-timeout must not be negative\n")
+		usage()
+	}
+
+	var normForm *norm.Form
+	switch *normalizeUnicode {
+	case "":
+	case "nfc":
+		form := norm.NFC
+		normForm = &form
+	case "nfd":
+		form := norm.NFD
+		normForm = &form
+	default:
+		errorf("unsupported -normalize-unicode form %q, expected nfc or nfd\n", *normalizeUnicode)
+		usage()
+	}
+
+	if *binaryBase64 && *format != "json" && *format != "jsonl" {
+		errorf("-binary-base64 can only be used with -format json or jsonl\n")
+		usage()
+	}
+
+	trailing, err := strconv.Unquote(`"` + *separatorTrailing + `"`)
+	if err != nil {
+		errorf("invalid -separator-trailing %q\n", *separatorTrailing)
+		usage()
+	}
+
+	if *sinceDays < 0 {
+		errorf("-since-days must not be negative\n")
+		usage()
+	}
+
+	var recencyCutoff time.Time
+	if *recencySince != "" {
+		if *sinceDays > 0 {
+			errorf("-recency-since and -since-days cannot be used together\n")
+			usage()
+		}
+		recencyCutoff, err = parseDate(*recencySince)
+		if err != nil {
+			errorf("%v\n", err)
+			usage()
+		}
+	}
+
+	if *rateLimit < 0 {
+		errorf("-rate-limit must not be negative\n")
+		usage()
+	}
+
+	if *wrapWidth < 0 {
+		errorf("-wrap must not be negative\n")
+		usage()
+	}
+
+	if *wrapWidth > 0 {
+		if !*singleFile && !*outPerDir {
+			errorf("-wrap requires -single or -out-per-dir\n")
+			usage()
+		}
+		warnf("-wrap inserts line breaks into file contents, which can change the meaning of code\n")
+	}
+
+	if *tocStats {
+		*toc = true
+	}
+
+	if *preserveStructure && (*singleFile || *outPerDir || *zipPath != "") {
+		errorf("-preserve-structure cannot be used with -single, -out-per-dir or -zip\n")
+		usage()
+	}
+
+	if *keepEmptyDirs && !*preserveStructure {
+		errorf("-keep-empty-dirs requires -preserve-structure\n")
+		usage()
+	}
+
+	if *splitBytes > 0 && (!*singleFile || *format == "json" || *format == "csv" || *toc) {
+		errorf("-split-bytes requires -single and cannot be used with -format json or csv, or -toc\n")
+		usage()
+	}
+
+	if *toStdout && (!*singleFile || *zipPath != "" || *splitBytes > 0 || *checksums) {
+		errorf("-stdout requires -single and cannot be used with -zip, -split-bytes or -checksums\n")
+		usage()
+	}
+
+	if *listFilesOnly && *treeJSONOnly {
+		errorf("-list-files and -tree-json cannot be used together\n")
+		usage()
+	}
+
+	if (*listFilesOnly || *treeJSONOnly) && (*destFolder != "" || *singleFile || *outPerDir || *zipPath != "" || *toStdout || *webhook != "" || *compare != "" || *printSourceHash || len(repos) > 1 || len(refs) > 1) {
+		errorf("-list-files and -tree-json cannot be used with -dest, -single, -out-per-dir, -zip, -stdout, -webhook, -compare, -print-source-hash or a repeated -repo or -ref\n")
+		usage()
+	}
+
+	if (*listFilesOnly || *treeJSONOnly) && (*contentTypes != "" || *maxLineLength > 0) {
+		errorf("-content-type and -max-line-length need file contents and cannot be used with -list-files or -tree-json\n")
+		usage()
+	}
+
+	if *pathComments && (*singleFile || *outPerDir || *preserveStructure) {
+		errorf("-path-comments cannot be used with -single, -out-per-dir or -preserve-structure, which keep paths already\n")
+		usage()
+	}
+
+	if *modeFromTree && (*singleFile || *outPerDir || *zipPath != "" || *fileModeFlag != "") {
+		errorf("-mode-from-tree cannot be used with -single, -out-per-dir, -zip or -file-mode\n")
+		usage()
+	}
+
+	if *webhook != "" && (!*singleFile || *zipPath != "" || *splitBytes > 0 || *checksums || *toStdout || *compare != "" || *printSourceHash) {
+		errorf("-webhook requires -single and cannot be used with -zip, -split-bytes, -checksums, -stdout, -compare or -print-source-hash\n")
+		usage()
+	}
+
+	if *webhookRetries < 0 {
+		errorf("-webhook-retries cannot be negative\n")
+		usage()
+	}
+
+	if *mergeBaseRef != "" && *changedSinceRef != "" {
+		errorf("-merge-base and -changed-since cannot be used together\n")
+		usage()
+	}
+
+	if *hunksOnly && ((*changedSinceRef == "" && *mergeBaseRef == "") || !*singleFile) {
+		errorf("-hunks-only requires -changed-since or -merge-base, and -single\n")
+		usage()
+	}
+
+	if *templatePath != "" && (!*singleFile || *format != "plain" || *toc || *splitBytes > 0 || *withCommitMessage) {
+		errorf("-template requires -single and cannot be used with -format, -toc, -split-bytes or -with-commit-message\n")
+		usage()
+	}
+
+	if *printSourceHash && (*toStdout || *zipPath == "-" || len(repos) > 1) {
+		errorf("-print-source-hash cannot be used with -stdout, -zip - or a repeated -repo\n")
+		usage()
+	}
+
+	if *compare != "" && (*zipPath != "" || *toStdout) {
+		errorf("-compare cannot be used with -zip or -stdout\n")
+		usage()
+	}
+
+	if len(refs) > 1 && (!*singleFile || (*format != "plain" && *format != "markdown" && *format != "org") || *templatePath != "" || *splitBytes > 0) {
+		errorf("a repeated -ref requires -single with -format plain, markdown or org, and cannot be used with -template or -split-bytes\n")
+		usage()
+	}
+
+	if *groupByLanguage && (!*singleFile || *format != "markdown" || *splitBytes > 0) {
+		errorf("-group-by-language requires -single and -format markdown, and cannot be used with -split-bytes\n")
+		usage()
+	}
+
+	if *diffInput != "" && *fileList != "" {
+		errorf("-diff cannot be used with -filelist\n")
+		usage()
+	}
+
+	if *squeezeBlankLines && *stripBlankLines {
+		errorf("-squeeze-blank and -strip-blank cannot be used together\n")
+		usage()
+	}
+
+	switch *tokensPerFile {
+	case "", "text", "json":
+	default:
+		errorf("-tokens-per-file must be text or json\n")
+		usage()
+	}
+
+	if *indexHTML && (*singleFile || *outPerDir || *zipPath != "" || *toStdout) {
+		errorf("-index-html cannot be used with -single, -out-per-dir, -zip or -stdout\n")
+		usage()
+	}
+
+	if *bom && !*singleFile {
+		errorf("-bom requires -single\n")
+		usage()
+	}
+
+	if *gzipOutput && (!*singleFile || *splitBytes > 0) {
+		errorf("-gzip requires -single and cannot be used with -split-bytes\n")
+		usage()
+	}
+
+	if *withCommitMessage && (!*singleFile || *format == "json" || *format == "jsonl" || *format == "csv") {
+		errorf("-with-commit-message requires -single and cannot be used with -format json, jsonl or csv\n")
+		usage()
+	}
+
+	// Structured formats have no place for the summary outside the content.
+	if *blame && (!*singleFile || *format == "json" || *format == "jsonl" || *format == "csv") {
+		errorf("-blame-summary requires -single and cannot be used with -format json, jsonl or csv\n")
+		usage()
+	}
+
+	switch *headerPosition {
+	case "top":
+	case "bottom", "both":
+		if *format != "plain" && *format != "markdown" {
+			errorf("-header-position can only be used with -format plain or markdown\n")
+			usage()
+		}
+		if *collapsible {
+			errorf("-header-position cannot be used with -collapsible\n")
+			usage()
+		}
+	default:
+		errorf("unsupported header position %q\n", *headerPosition)
+		usage()
+	}
+
+	if *collapsible && *format != "markdown" {
+		errorf("-collapsible can only be used with -format markdown\n")
+		usage()
+	}
+
+	if *toc && (!*singleFile || (*format != "plain" && *format != "markdown")) {
+		errorf("-toc requires -single with -format plain or markdown\n")
+		usage()
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		errorf("%v\n", err)
+		os.Exit(1)
+	}
+
+	pipelines, err := parseTransforms(cfg.Transforms)
+	if err != nil {
+		errorf("%v\n", err)
+		os.Exit(1)
+	}
+
+	// The flag overrides the config file, which overrides the built-in
+	// languages.
+	langMap, err := parseLangMap(*langMapFlag)
+	if err != nil {
+		errorf("%v\n", err)
+		usage()
+	}
+	mapLanguages(cfg.LangMap)
+	mapLanguages(langMap)
+
+	extensions, err := expandExtGroups(splitList(*extsGroup), cfg)
+	if err != nil {
+		errorf("%v\n", err)
+		usage()
+	}
+	extensions = append(extensions, splitList(*exts)...)
+
+	destMode, err := parseMode(*destModeFlag)
+	if err != nil {
+		errorf("-dest-mode: %v\n", err)
+		usage()
+	}
+
+	fileMode, err := parseMode(*fileModeFlag)
+	if err != nil {
+		errorf("-file-mode: %v\n", err)
+		usage()
+	}
+
+	var listedFiles []string
+	listSource := "file list"
+	if *fileList != "" {
+		listedFiles, err = loadFileList(*fileList)
+		if err != nil {
+			errorf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *diffInput != "" {
+		listedFiles, err = loadDiffPaths(*diffInput)
+		if err != nil {
+			errorf("%v\n", err)
+			os.Exit(1)
+		}
+		if len(listedFiles) == 0 {
+			errorf("the diff does not change any file\n")
+			os.Exit(1)
+		}
+		listSource = "diff"
+	}
+
+	var tmpl *template.Template
+	if *templatePath != "" {
+		tmpl, err = loadTemplate(*templatePath)
+		if err != nil {
+			errorf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var rootCAs *x509.CertPool
+	if *caBundle != "" {
+		rootCAs, err = loadCABundle(*caBundle)
+		if err != nil {
+			errorf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	headers, err := parseHTTPHeaders(httpHeaders)
+	if err != nil {
+		errorf("%v\n", err)
+		usage()
+	}
+
+	rewriteRules, err := parseRewrites(rewrites)
+	if err != nil {
+		errorf("%v\n", err)
+		usage()
+	}
+
+	lineRanges, err := parseRanges(ranges)
+	if err != nil {
+		errorf("%v\n", err)
+		usage()
+	}
+
+	if len(lineRanges) > 0 && !*singleFile && !*outPerDir {
+		errorf("-ranges requires -single or -out-per-dir\n")
+		usage()
+	}
+
+	// With several -ref values, the first one is used for the clone and
+	// the cache key; any -ref already makes the clone fetch full history.
+	firstRef := ""
+	if len(refs) > 0 {
+		firstRef = refs[0]
+	}
+
+	opts := &Options{
+		RepoURL:          repoURL,
+		DestFolder:       *destFolder,
+		ExcludeDirs:      splitList(*excludeDirs),
+		Include:          *include,
+		Extensions:       extensions,
+		SingleFile:       *singleFile,
+		MaxSize:          *maxSize,
+		MaxFiles:         *maxFiles,
+		Comment:          *commentStyle,
+		OutPerDir:        *outPerDir,
+		PerTopLevel:      *perTopLevel,
+		TopLevelIndex:    *splitByTopLevel,
+		Redact:           *redactSecrets,
+		Subpath:          cleanSubpath(*subpath),
+		Format:           *format,
+		Pretty:           *pretty,
+		BinaryBase64:     *binaryBase64,
+		WithContent:      *withContent,
+		NormalizeUnicode: normForm,
+		FilterCmd:        filterArgs,
+		FilterExts:       splitList(*filterExts),
+		FilterTimeout:    *filterTimeout,
+
+		SubmoduleContents:   *submoduleContents,
+		AddedSince:          *addedSince,
+		ChangedSince:        *changedSinceRef,
+		MergeBase:           *mergeBaseRef,
+		HunksOnly:           *hunksOnly,
+		RespectGitignore:    *respectGitignore,
+		Template:            tmpl,
+		Dedent:              *dedentFiles,
+		Bare:                *bare,
+		RelativeTo:          cleanSubpath(*relativeTo),
+		Jobs:                *jobs,
+		Zip:                 *zipPath,
+		Ref:                 firstRef,
+		DetectDefaultBranch: *detectDefault,
+		NoPrompt:            *noPrompt,
+		Mirror:              *mirror,
+		KeepClone:           *keepClone,
+		Refs:                refs,
+		CloneConcurrency:    *cloneConcurrency,
+		Minify:              *minifyFiles,
+		Rewrites:            rewriteRules,
+		Checksums:           *checksums,
+		TOC:                 *toc,
+		Trailing:            trailing,
+		Pins:                pins,
+		PinReadme:           *pinReadme,
+		Quiet:               *quiet,
+		Stdout:              *toStdout,
+		ListFiles:           *listFilesOnly,
+		TreeJSON:            *treeJSONOnly,
+		Webhook:             *webhook,
+		WebhookRetries:      *webhookRetries,
+		DestMode:            destMode,
+		FileMode:            fileMode,
+		ModeFromTree:        *modeFromTree,
+		PathComments:        *pathComments,
+		FileList:            listedFiles,
+		FileListSource:      listSource,
+		Wrap:                *wrapWidth,
+		LengthPrefix:        *lengthPrefix,
+		MaxLineLength:       *maxLineLength,
+		Collapsible:         *collapsible,
+		Traversal:           *traversal,
+		Sort:                *sortOrder,
+		BlameSummary:        *blame,
+		PreserveStructure:   *preserveStructure,
+		KeepEmptyDirs:       *keepEmptyDirs,
+		HeaderPosition:      *headerPosition,
+		MaxCloneSize:        *maxCloneSize,
+		RateLimit:           *rateLimit,
+		StripImports:        *stripImportBlocks,
+		SplitBytes:          *splitBytes,
+		WithCommitMessage:   *withCommitMessage,
+		Gzip:                *gzipOutput,
+		SinceDays:           *sinceDays,
+		RecencySince:        recencyCutoff,
+		HTTPHeaders:         headers,
+		IncludeWorktree:     *includeWorktree,
+		BOM:                 *bom,
+		SkipLFS:             *skipLFS,
+		SkipHidden:          *skipHidden,
+		ExcludeGenerated:    *excludeGenerated,
+		GroupByLanguage:     *groupByLanguage,
+		ResolveSymlinks:     *resolveSymlinks,
+		SqueezeBlank:        *squeezeBlankLines,
+		StripBlank:          *stripBlankLines,
+		TokensPerFile:       *tokensPerFile,
+		IndexHTML:           *indexHTML,
+		MaxTreeFiles:        *maxTreeFiles,
+		Force:               *force,
+		RootCAs:             rootCAs,
+		FetchLFS:            *fetchLFS,
+		CollisionStrategy:   *collisionStrategy,
+		ContentTypes:        splitList(*contentTypes),
+		ReportLargest:       *reportLargestFiles,
+		Transforms:          pipelines,
+		TOCStats:            *tocStats,
+		ContinueOnError:     *continueOnError,
+		Ranges:              lineRanges,
+	}
+
+	if *keepClone && !*mirror {
+		errorf("-keep-clone requires -mirror\n")
+		usage()
+	}
+
+	cache := ""
+	if *cacheDir != "" && !*noCache && !*mirror {
+		cache = *cacheDir
+	}
+	configureRepo(opts, *archive, cache)
+
+	if *mirror && len(repos) <= 1 && (opts.Local || opts.Archive) {
+		errorf("-mirror requires a remote -repo\n")
+		usage()
+	}
+
+	if opts.ResolveSymlinks && !opts.Local {
+		errorf("-resolve-symlinks requires a local -repo\n")
+		usage()
+	}
+
+	if opts.IncludeWorktree {
+		if !opts.Local || opts.Ref != "" {
+			errorf("-include-worktree requires a local -repo and cannot be used with -ref\n")
+			usage()
+		}
+		warnf("-include-worktree reads uncommitted changes, so the output may not match any commit\n")
+	}
+
+	if opts.RateLimit > 0 {
+		opts.Throttle = newThrottle(opts.RateLimit)
+	}
+	installHTTPTransport(opts)
+
+	// Listing refs needs the same transport and credentials as a clone,
+	// but nothing else of the run.
+	if *listRefsOnly {
+		err := listRefs(context.Background(), os.Stdout, opts)
+		if err != nil {
+			errorf("%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	closeLog := func() {}
+	if *logFile != "" {
+		f, err := os.Create(*logFile)
+		if err != nil {
+			errorf("error creating log file: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		closeLog = func() { f.Close() }
+		opts.Logger = slog.New(slog.NewJSONHandler(f, nil))
+	}
+	log := opts.log()
+
+	removeMirror := func() {}
+	if opts.Mirror {
+		opts.MirrorDir, err = os.MkdirTemp("", "gitflat-mirror-")
+		if err != nil {
+			errorf("error creating mirror directory: %v\n", err)
+			closeLog()
+			os.Exit(1)
+		}
+		if opts.KeepClone {
+			removeMirror = func() { infof("Mirror clone kept in %s\n", opts.MirrorDir) }
+		} else {
+			removeMirror = func() { os.RemoveAll(opts.MirrorDir) }
+		}
+	}
+
+	// Every repository of a bundle is read the way it would be on its
+	// own.
+	if len(repos) > 1 {
+		for _, url := range repos {
+			repoOpts := *opts
+			repoOpts.RepoURL = url
+			repoOpts.Repos = nil
+			repoOpts.Local, repoOpts.Archive, repoOpts.CacheDir = false, false, ""
+			configureRepo(&repoOpts, *archive, cache)
+			opts.Repos = append(opts.Repos, &repoOpts)
+		}
+	}
+
+	if *printSourceHash {
+		opts.SourceHash = sha256.New()
+		opts.HashOnly = *destFolder == "" && *zipPath == "" && *compare == ""
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+	log.Info("run started", "repo", opts.RepoURL, "dest", opts.DestFolder)
+
+	if *compare != "" {
+		err = compareOutput(ctx, opts, *compare)
+	} else {
+		err = run(ctx, opts)
+	}
+
+	if err != nil {
+		log.Error("run failed", "error", err, "duration", time.Since(start))
+		errorf("%v\n", err)
+		removeMirror()
+		closeLog()
+		os.Exit(1)
+	}
+	log.Info("run finished", "duration", time.Since(start))
+
+	if opts.Throttle != nil {
+		opts.Throttle.report(opts)
+	}
+
+	source := strings.Join(repos, ", ")
+	if opts.SourceHash != nil {
+		fmt.Printf("%x\n", opts.SourceHash.Sum(nil))
+	}
+
+	switch {
+	case opts.HashOnly, opts.ListFiles, opts.TreeJSON:
+	case *compare != "":
+		infof("Output for %s matches %s\n", source, *compare)
+	case opts.Zip == "-":
+		// stdout carries the archive, so the summary goes to stderr.
+		infof("Selected files from %s have been flattened to a zip archive on stdout\n", source)
+	case opts.Zip != "":
+		infof("Selected files from %s have been flattened to the zip archive %s\n", source, opts.Zip)
+	case opts.Webhook != "":
+		infof("Selected files from %s have been flattened and posted to %s\n", source, opts.Webhook)
+	case opts.Stdout:
+		infof("Selected files from %s have been flattened to stdout\n", source)
+	case opts.SingleFile && opts.SplitBytes > 0:
+		infof("Selected files from %s have been flattened to numbered chunk files in %s\n", source, *destFolder)
+	case opts.SingleFile:
+		infof("Selected files from %s have been flattened to a single file in %s\n", source, *destFolder)
+	case opts.TopLevelIndex:
+		infof("Selected files from %s have been flattened to one file per top-level directory with an index in %s\n", source, *destFolder)
+	case opts.PerTopLevel:
+		infof("Selected files from %s have been flattened to one file per top-level directory in %s\n", source, *destFolder)
+	case opts.OutPerDir:
+		infof("Selected files from %s have been flattened to one file per directory in %s\n", source, *destFolder)
+	default:
+		infof("Selected files from %s have been flattened to %s\n", source, *destFolder)
+	}
+	removeMirror()
+}
+
+// run writes the output selected by opts.
+func run(ctx context.Context, opts *Options) error {
+	var err error
+	switch {
+	case opts.HashOnly:
+		err = flattenTo(ctx, io.Discard, opts)
+	case opts.ListFiles:
+		err = listFiles(ctx, os.Stdout, opts)
+	case opts.TreeJSON:
+		err = writeTreeJSON(ctx, os.Stdout, opts)
+	case opts.Zip != "":
+		err = flattenToZipFile(ctx, opts.Zip, opts)
+	case opts.SingleFile && opts.SplitBytes > 0:
+		err = flattenToChunks(ctx, opts)
+	case opts.Webhook != "":
+		err = postWebhook(ctx, opts)
+	case opts.Stdout:
+		err = writeSingle(ctx, os.Stdout, opts)
+	case opts.SingleFile:
+		err = flattenToSingleFile(ctx, opts)
+	case opts.OutPerDir:
+		err = flattenPerDir(ctx, opts)
+	default:
+		err = flatten(ctx, opts)
+	}
+
+	if err == nil && opts.Checksums {
+		err = writeChecksums(opts.DestFolder, opts)
+	}
+	return err
+}
+
+// configureRepo sets how opts.RepoURL is read. Archives and local
+// repositories are read in place; there is nothing to clone or cache.
+// Other repositories are mirrored with -mirror, or cached in cacheDir when
+// set. Mirrors and cached clones have no working tree, so they are always
+// read directly.
+func configureRepo(opts *Options, archive bool, cacheDir string) {
+	if archive || isArchiveURL(opts.RepoURL) {
+		opts.Archive = true
+		opts.Bare = true
+	} else if isLocalRepo(opts.RepoURL) {
+		opts.Local = true
+		opts.Bare = true
+	}
+
+	if !opts.Local && !opts.Archive && opts.Mirror {
+		opts.Bare = true
+	} else if !opts.Local && !opts.Archive && cacheDir != "" {
+		opts.CacheDir = cacheDir
+		opts.Bare = true
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: gitflat -repo <repository_url> -dest <destination_folder> [options]")
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func flatten(ctx context.Context, opts *Options) error {
+	var repo *git.Repository
+	var err error
+	if opts.Bare {
+		repo, err = cloneRepo(ctx, opts)
+	} else {
+		repo, err = checkoutRepo(ctx, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.Bare {
+		err = createDest(opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	tree, err := targetTree(repo, opts.Ref)
+	if err != nil {
+		return err
+	}
+
+	written := make(map[string]bool)
+	var index []indexEntry
+	namer := newFlatNamer(opts.CollisionStrategy)
+	err = processFiles(ctx, repo, tree, opts, func(f *object.File, content string) error {
+		var targetPath string
+		if opts.PreserveStructure {
+			var err error
+			targetPath, err = preservedPath(opts.DestFolder, f.Name)
+			if err != nil {
+				return err
+			}
+			err = os.MkdirAll(filepath.Dir(targetPath), 0755)
+			if err != nil {
+				return err
+			}
+			written[targetPath] = true
+		} else {
+			targetPath = filepath.Join(opts.DestFolder, namer.name(f.Name))
+			if opts.PathComments {
+				content = withPathComment(f.Name, content)
+			}
+		}
+
+		if opts.IndexHTML {
+			index = append(index, indexEntry{Path: displayPath(f.Name, opts), Href: relativeHref(opts.DestFolder, targetPath)})
+		}
+		if opts.ModeFromTree {
+			return writeFile(targetPath, []byte(content), treeFileMode(f))
+		}
+		return writeOutput(targetPath, []byte(content), opts)
+	})
+	if err != nil {
+		return fmt.Errorf("error processing files: %w", err)
+	}
+
+	err = tidyDest(tree, written, opts)
+	if err == nil && opts.IndexHTML {
+		err = writeIndexHTML(index, opts)
+	}
+	return err
+}
+
+// tidyDest removes what is left of the checkout in the destination folder
+// once the files have been written, or adds the empty directories of
+// -keep-empty-dirs to a bare -preserve-structure output.
+func tidyDest(tree *object.Tree, written map[string]bool, opts *Options) error {
+	if opts.PreserveStructure {
+		var err error
+		if opts.Bare {
+			if !opts.KeepEmptyDirs {
+				return nil
+			}
+			err = createSkeleton(tree, opts)
+		} else {
+			err = pruneCheckout(opts.DestFolder, written, opts.KeepEmptyDirs)
+		}
+		if err != nil {
+			return fmt.Errorf("error cleaning up destination folder: %w", err)
+		}
+		return nil
+	}
+
+	if opts.Bare {
+		return nil
+	}
+
+	err := cleanupDirectories(opts.DestFolder)
+	if err != nil {
+		return fmt.Errorf("error removing directories: %w", err)
+	}
+
+	return nil
+}
+
+// checkoutRepo clones the repository with a working tree into the
+// destination folder. The checkout is removed again once the files have
+// been flattened.
+func checkoutRepo(ctx context.Context, opts *Options) (*git.Repository, error) {
+	err := createDest(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	log := opts.log()
+	var repo *git.Repository
+	err = withAuthPrompt(opts, func() error {
+		err := detectDefaultBranch(ctx, opts)
+		if err != nil {
+			return err
+		}
+
+		cloneOpts := &git.CloneOptions{
+			URL:               opts.RepoURL,
+			Auth:              opts.Auth,
+			ReferenceName:     opts.DefaultBranch,
+			RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+		}
+		// With a subpath only that directory is checked out, which keeps
+		// unrelated parts of a monorepo off the disk.
+		if opts.Subpath != "" {
+			cloneOpts.NoCheckout = true
+			cloneOpts.RecurseSubmodules = git.NoRecurseSubmodules
+		}
+
+		start := time.Now()
+		log.Info("clone started", "url", opts.RepoURL, "path", opts.DestFolder)
+		repo, err = git.PlainCloneContext(ctx, opts.DestFolder, false, cloneOpts)
+		if err != nil {
+			log.Error("clone failed", "url", opts.RepoURL, "error", err)
+			return fmt.Errorf("error cloning repository: %w", err)
+		}
+		log.Info("clone finished", "url", opts.RepoURL, "duration", time.Since(start))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Subpath != "" {
+		err = sparseCheckout(repo, opts.Subpath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return repo, nil
+}
+
+// utf8BOM is the UTF-8 encoded byte order mark written with -bom.
+const utf8BOM = "\uFEFF"
+
+func flattenToSingleFile(ctx context.Context, opts *Options) error {
+	err := createDest(opts)
+	if err != nil {
+		return err
+	}
+
+	ext := newFormatter(opts).ext()
+	if opts.Template != nil {
+		ext = templateExt(opts.Template)
+	}
+	name := "flattened_repo" + ext
+	if opts.Gzip {
+		name += ".gz"
+	}
+
+	outputFile, err := createOutput(filepath.Join(opts.DestFolder, name), opts)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %w", err)
+	}
+	defer outputFile.Close()
+
+	err = writeSingle(ctx, outputFile, opts)
+	if err != nil {
+		return err
+	}
+	return outputFile.Close()
+}
+
+// writeSingle writes the single-file output to w, compressed with -gzip and
+// preceded by a byte order mark with -bom.
+func writeSingle(ctx context.Context, w io.Writer, opts *Options) error {
+	var gz *gzip.Writer
+	if opts.Gzip {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+
+	if opts.BOM {
+		_, err := io.WriteString(w, utf8BOM)
+		if err != nil {
+			return fmt.Errorf("error writing output: %w", err)
+		}
+	}
+
+	err := flattenTo(ctx, w, opts)
+	if err != nil {
+		return err
+	}
+
+	if gz != nil {
+		// Close flushes the compressed data and writes the gzip footer.
+		err = gz.Close()
+		if err != nil {
+			return fmt.Errorf("error compressing output: %w", err)
+		}
+	}
+	return nil
+}
+
+// listFiles prints the repository paths of the files selected by opts to
+// w, one per line. Files are never read, so filters that need their
+// contents do not apply.
+func listFiles(ctx context.Context, w io.Writer, opts *Options) error {
+	repo, err := cloneRepo(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	tree, err := targetTree(repo, opts.Ref)
+	if err != nil {
+		return err
+	}
+
+	err = processFiles(ctx, repo, tree, opts, func(f *object.File, _ string) error {
+		_, err := fmt.Fprintln(w, f.Name)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error processing files: %w", err)
+	}
+	return nil
+}
+
+// flattenTo clones the repository into memory and streams the single-file
+// output to w. Nothing is written to disk, so w can be any sink: a file, a
+// buffer, an HTTP response or a compressing writer.
+func flattenTo(ctx context.Context, w io.Writer, opts *Options) error {
+	if len(opts.Repos) > 1 {
+		return flattenRepos(ctx, w, opts)
+	}
+
+	repo, err := cloneRepo(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	if len(opts.Refs) <= 1 {
+		return flattenRepo(ctx, w, repo, opts)
+	}
+
+	// Every ref gets its own labeled section, selected with the same
+	// filters.
+	for i, ref := range opts.Refs {
+		header := fmt.Sprintf("=== ref: %s ===\n\n", ref)
+		if i > 0 {
+			header = "\n" + header
+		}
+		_, err = io.WriteString(w, header)
+		if err != nil {
+			return fmt.Errorf("error writing output: %w", err)
+		}
+
+		refOpts := *opts
+		refOpts.Ref = ref
+		err = flattenRepo(ctx, w, repo, &refOpts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", ref, err)
+		}
+	}
+	return nil
+}
+
+// flattenRepo writes the selected files of an already opened repository
+// to w in the configured format, without cloning. The tree is the one
+// opts.Ref resolves to, or HEAD.
+func flattenRepo(ctx context.Context, w io.Writer, repo *git.Repository, opts *Options) error {
+	tree, err := targetTree(repo, opts.Ref)
+	if err != nil {
+		return err
+	}
+
+	if opts.Template != nil {
+		return renderTemplate(ctx, w, repo, tree, opts)
+	}
+
+	format := newFormatter(opts)
+
+	writeCommit := func() error { return nil }
+	if opts.WithCommitMessage {
+		name, text, err := commitEntry(repo, opts.Ref)
+		if err != nil {
+			return err
+		}
+		writeCommit = func() error { return format.file(w, name, text) }
+	}
+
+	// The table of contents leads the output, and -group-by-language
+	// reorders it, so the files are collected first and written once the
+	// selection is known.
+	buffered := opts.TOC || opts.GroupByLanguage
+	var entries []tocEntry
+	write := func(f *object.File, content string) error {
+		return format.file(w, displayPath(f.Name, opts), content)
+	}
+	if buffered {
+		write = func(f *object.File, content string) error {
+			entries = append(entries, tocEntry{name: displayPath(f.Name, opts), content: content})
+			return nil
+		}
+	} else {
+		err = format.begin(w)
+		if err == nil {
+			err = writeCommit()
+		}
+		if err != nil {
+			return fmt.Errorf("error writing output: %w", err)
+		}
+	}
+
+	err = processFiles(ctx, repo, tree, opts, write)
+	if err != nil {
+		return fmt.Errorf("error processing files: %w", err)
+	}
+
+	if buffered {
+		if opts.GroupByLanguage {
+			sortByLanguage(entries)
+		}
+
+		// The formats that support -toc have no preamble, so the commit
+		// can come before the table of contents.
+		err = writeCommit()
+		if err == nil && opts.TOC {
+			err = writeTOC(w, entries, opts)
+		}
+		if err == nil {
+			err = format.begin(w)
+		}
+		group := ""
+		for _, entry := range entries {
+			if err != nil {
+				break
+			}
+			if opts.GroupByLanguage {
+				if name := languageName(entry.name); name != group {
+					group = name
+					_, err = fmt.Fprintf(w, "## %s\n\n", group)
+					if err != nil {
+						break
+					}
+				}
+			}
+			err = format.file(w, entry.name, entry.content)
+		}
+		if err != nil {
+			return fmt.Errorf("error writing output: %w", err)
+		}
+	}
+
+	err = format.end(w)
+	if err != nil {
+		return fmt.Errorf("error writing output: %w", err)
+	}
+
+	return nil
+}
+
+// cloneRepo clones the repository into memory, or opens and updates its
+// cached clone when a cache directory is configured. Refs a clone does not
+// fetch, such as those of pull requests, are fetched afterwards.
+func cloneRepo(ctx context.Context, opts *Options) (*git.Repository, error) {
+	if opts.repo != nil {
+		return opts.repo, nil
+	}
+	if opts.Local {
+		return openLocalRepo(opts)
+	}
+	if opts.Archive {
+		return archiveRepo(ctx, opts)
+	}
+
+	var repo *git.Repository
+	err := withAuthPrompt(opts, func() error {
+		var err error
+		repo, err = remoteRepo(ctx, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// remoteRepo clones or updates the repository of a remote -repo and
+// fetches the refs it needs.
+func remoteRepo(ctx context.Context, opts *Options) (*git.Repository, error) {
+	err := detectDefaultBranch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var repo *git.Repository
+	switch {
+	case opts.Mirror:
+		// A mirror already holds every ref, special ones included.
+		return mirrorRepo(ctx, opts)
+	case opts.CacheDir != "":
+		repo, err = cachedRepo(ctx, opts)
+	default:
+		repo, err = memoryClone(ctx, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	refs := opts.Refs
+	if len(refs) == 0 && opts.Ref != "" {
+		refs = []string{opts.Ref}
+	}
+	err = fetchSpecialRefs(ctx, repo, opts, refs)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// memoryClone clones -repo into memory.
+func memoryClone(ctx context.Context, opts *Options) (*git.Repository, error) {
+	log := opts.log()
+	start := time.Now()
+	log.Info("clone started", "url", opts.RepoURL)
+
+	var repo *git.Repository
+	var err error
+	if shallowClone(opts) {
+		repo, err = git.CloneContext(ctx, memory.NewStorage(), nil, &git.CloneOptions{
+			URL:           opts.RepoURL,
+			Auth:          opts.Auth,
+			ReferenceName: opts.DefaultBranch,
+			Depth:         1,
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Info("shallow clone failed, cloning in full", "url", opts.RepoURL, "error", err)
+			repo = nil
+		}
+	}
+	if repo == nil {
+		repo, err = git.CloneContext(ctx, memory.NewStorage(), nil, &git.CloneOptions{
+			URL:           opts.RepoURL,
+			Auth:          opts.Auth,
+			ReferenceName: opts.DefaultBranch,
+		})
+	}
+	if err != nil {
+		log.Error("clone failed", "url", opts.RepoURL, "error", err)
+		return nil, fmt.Errorf("error cloning repository: %w", err)
+	}
+
+	log.Info("clone finished", "url", opts.RepoURL, "duration", time.Since(start))
+	return repo, nil
+}
+
+// sparseCheckout checks out only dir from HEAD into the worktree.
+func sparseCheckout(repo *git.Repository, dir string) error {
+	ref, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("error getting HEAD: %w", err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("error getting worktree: %w", err)
+	}
+
+	err = wt.Checkout(&git.CheckoutOptions{
+		Branch:                    ref.Name(),
+		SparseCheckoutDirectories: []string{dir},
+	})
+	if err != nil {
+		return fmt.Errorf("error checking out %s: %w", dir, err)
+	}
+	return nil
+}
+
+// cleanSubpath normalizes a user supplied subpath to a slash separated,
+// repo-relative directory.
+func cleanSubpath(dir string) string {
+	dir = strings.Trim(path.Clean(filepath.ToSlash(dir)), "/")
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// cleanupDirectories removes every directory left in destFolder by the
+// checkout, keeping only the flattened files. It attempts every directory
+// even when some fail, and reports all that could not be removed.
+func cleanupDirectories(destFolder string) error {
+	entries, err := os.ReadDir(destFolder)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(destFolder, entry.Name())
+		err := os.RemoveAll(dir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not remove %s: %w", dir, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func shouldExclude(path string, excludeDirs []string, include string) bool {
+	// Directories must match whole path components, so docs selects or
+	// excludes docs/ but not docsite/.
+	if include != "" {
+		return !inDir(path, strings.TrimSuffix(include, "/"))
+	}
+	for _, dir := range excludeDirs {
+		dir = strings.TrimSuffix(dir, "/")
+		if dir != "" && inDir(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHidden reports whether a path has a component starting with a dot.
+// With -include, only the components below the included directory count,
+// so naming a hidden directory such as .github selects its files, while
+// dotfiles inside an included directory are still hidden.
+func isHidden(path, include string) bool {
+	if include != "" {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(include, "/")+"/")
+	}
+	for _, part := range strings.Split(path, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasValidExtension(path string, extensions []string) bool {
+	if len(extensions) == 0 || (len(extensions) == 1 && extensions[0] == "") {
+		return true
+	}
+	for _, validExt := range extensions {
+		if validExt != "" && strings.HasSuffix(path, validExt) {
+			return true
+		}
+	}
+	return false
+}
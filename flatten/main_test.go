@@ -0,0 +1,75 @@
+package flatten
+
+import "testing"
+
+func TestIsHidden(t *testing.T) {
+	tests := []struct {
+		path, include string
+		want          bool
+	}{
+		{"a/b/c", "", false},
+		{"a.b/c.go", "", false},
+		{".env", "", true},
+		{"a/.env", "", true},
+		{"a/.b/c", "", true},
+		{".github/x", "", true},
+
+		// Naming a hidden directory with -include selects its files.
+		{".github/x", ".github", false},
+		{".github/x", ".github/", false},
+		{".github/workflows/ci.yml", ".github", false},
+		{"a/.b/c", "a/.b", false},
+
+		// Dotfiles and dot-directories below the included one stay hidden.
+		{"a/.env", "a", true},
+		{"a/.b/c", "a", true},
+		{"docs/.pages", "docs", true},
+		{"docs/guide.md", "docs", false},
+		{".github/.hidden/x", ".github", true},
+	}
+
+	for _, tt := range tests {
+		if got := isHidden(tt.path, tt.include); got != tt.want {
+			t.Errorf("isHidden(%q, %q) = %v, want %v", tt.path, tt.include, got, tt.want)
+		}
+	}
+}
+
+func TestShouldExclude(t *testing.T) {
+	tests := []struct {
+		path        string
+		excludeDirs []string
+		include     string
+		want        bool
+	}{
+		{"a/b.go", nil, "", false},
+		{"vendor/x.go", []string{"vendor"}, "", true},
+		{"a/vendor/x.go", []string{"vendor"}, "", false},
+		{"vendor/x.go", []string{"vendor/"}, "", true},
+		{"vendor", []string{"vendor"}, "", true},
+		{"docs/x.md", []string{"docs"}, "", true},
+		{"docsite/x.md", []string{"docs"}, "", false},
+		{"docs.md", []string{"docs"}, "", false},
+		{"a/b/x.go", []string{"a/b"}, "", true},
+		{"a/bc/x.go", []string{"a/b"}, "", false},
+		{"x.go", []string{""}, "", false},
+
+		{"docs/x.md", nil, "docs", false},
+		{"docs/x.md", nil, "docs/", false},
+		{"docs/.pages", nil, "docs", false},
+		{"docsite/x.md", nil, "docs", true},
+		{"x.md", nil, "docs", true},
+
+		// Selection by -include is independent of hidden components; those
+		// are left to isHidden.
+		{".github/x", nil, ".github", false},
+		{"a/.b/c", nil, "a", false},
+		{"a/.github/x", nil, ".github", true},
+	}
+
+	for _, tt := range tests {
+		if got := shouldExclude(tt.path, tt.excludeDirs, tt.include); got != tt.want {
+			t.Errorf("shouldExclude(%q, %q, %q) = %v, want %v", tt.path, tt.excludeDirs, tt.include, got, tt.want)
+		}
+	}
+}
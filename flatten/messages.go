@@ -0,0 +1,57 @@
+package flatten
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// messages is where status messages go: stderr, so that they never mix
+// with output written to stdout. main configures it from -quiet and
+// -no-color.
+var messages = &messageWriter{w: os.Stderr}
+
+type messageWriter struct {
+	w     io.Writer
+	quiet bool
+	color bool
+}
+
+// ANSI escape sequences for the message prefixes.
+const (
+	colorRed    = "\033[31m"
+	colorYellow = "\033[33m"
+	colorReset  = "\033[0m"
+)
+
+// infof prints an informational message, unless -quiet is set.
+func infof(format string, args ...any) {
+	if messages.quiet {
+		return
+	}
+	fmt.Fprintf(messages.w, format, args...)
+}
+
+// warnf prints a warning. Warnings are shown even with -quiet.
+func warnf(format string, args ...any) {
+	fmt.Fprintf(messages.w, messages.prefix("Warning:", colorYellow)+" "+format, args...)
+}
+
+// errorf prints an error. Errors are shown even with -quiet.
+func errorf(format string, args ...any) {
+	fmt.Fprintf(messages.w, messages.prefix("Error:", colorRed)+" "+format, args...)
+}
+
+func (m *messageWriter) prefix(label, color string) string {
+	if !m.color {
+		return label
+	}
+	return color + label + colorReset
+}
+
+// useColor reports whether messages may be colored: stderr must be a
+// terminal, and neither -no-color nor the NO_COLOR convention may ask
+// otherwise.
+func useColor(noColor bool) bool {
+	return !noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stderr)
+}
@@ -0,0 +1,49 @@
+package flatten
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"strings"
+)
+
+// minify removes insignificant whitespace from JSON, JavaScript and CSS
+// files and returns other content unchanged. JSON is compacted by a real
+// parser and left alone if it does not parse. JavaScript and CSS only get
+// a conservative per-line treatment that never joins lines, so automatic
+// semicolon insertion is unaffected.
+func minify(name, content string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json":
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, []byte(content)); err != nil {
+			return content
+		}
+		return buf.String()
+	case ".js", ".mjs", ".cjs", ".css":
+		return collapseLines(content)
+	default:
+		return content
+	}
+}
+
+// collapseLines trims the whitespace around every line and drops blank
+// lines. Template literals can span lines with meaningful indentation, so
+// files containing backticks only lose trailing whitespace.
+func collapseLines(content string) string {
+	keepIndent := strings.Contains(content, "`")
+
+	var b strings.Builder
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if !keepIndent {
+			line = strings.TrimLeft(line, " \t")
+			if line == "" {
+				continue
+			}
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,48 @@
+package flatten
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// mirrorRepo returns a mirror clone of the repository in the -mirror
+// directory, cloning it on first use. A mirror holds every ref of the
+// remote, so branches, tags and pull request refs all resolve without
+// another fetch.
+func mirrorRepo(ctx context.Context, opts *Options) (*git.Repository, error) {
+	sum := sha256.Sum256([]byte(opts.RepoURL))
+	dir := filepath.Join(opts.MirrorDir, hex.EncodeToString(sum[:8]))
+
+	repo, err := git.PlainOpen(dir)
+	if err == nil {
+		return repo, nil
+	}
+	if !errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, fmt.Errorf("error opening mirror clone %s: %w", dir, err)
+	}
+
+	log := opts.log()
+	start := time.Now()
+	log.Info("clone started", "url", opts.RepoURL, "path", dir, "mirror", true)
+	repo, err = git.PlainCloneContext(ctx, dir, true, &git.CloneOptions{
+		URL:           opts.RepoURL,
+		Auth:          opts.Auth,
+		ReferenceName: opts.DefaultBranch,
+		Mirror:        true,
+	})
+	if err != nil {
+		log.Error("clone failed", "url", opts.RepoURL, "error", err)
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("error cloning repository: %w", err)
+	}
+	log.Info("clone finished", "url", opts.RepoURL, "duration", time.Since(start))
+	return repo, nil
+}
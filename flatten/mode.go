@@ -0,0 +1,113 @@
+package flatten
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	defaultDestMode os.FileMode = 0755
+	defaultFileMode os.FileMode = 0644
+	// executableFileMode is the mode of executable files with
+	// -mode-from-tree.
+	executableFileMode os.FileMode = 0755
+)
+
+// parseMode parses an octal permission mode such as 0700. An empty string
+// leaves the default in place.
+func parseMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid permission mode %q", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// createDest creates the destination folder. With -dest-mode the mode is
+// applied explicitly, so neither the umask nor an existing folder leaves
+// it more permissive than asked for.
+func createDest(opts *Options) error {
+	mode := opts.DestMode
+	if mode == 0 {
+		mode = defaultDestMode
+	}
+
+	err := os.MkdirAll(opts.DestFolder, mode)
+	if err != nil {
+		return fmt.Errorf("error creating destination folder: %w", err)
+	}
+
+	if opts.DestMode != 0 {
+		err = os.Chmod(opts.DestFolder, opts.DestMode)
+		if err != nil {
+			return fmt.Errorf("error setting destination folder mode: %w", err)
+		}
+	}
+	return nil
+}
+
+// createOutput creates or truncates an output file with the mode set by
+// -file-mode.
+func createOutput(name string, opts *Options) (*os.File, error) {
+	return createFile(name, opts.FileMode)
+}
+
+// createFile creates or truncates a file with mode, or with the default
+// mode, subject to the umask, when mode is 0.
+func createFile(name string, mode os.FileMode) (*os.File, error) {
+	perm := mode
+	if perm == 0 {
+		perm = defaultFileMode
+	}
+
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	// OpenFile keeps the mode of files that already exist.
+	if mode != 0 {
+		err = f.Chmod(mode)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// writeOutput writes an output file with the mode set by -file-mode.
+func writeOutput(name string, data []byte, opts *Options) error {
+	return writeFile(name, data, opts.FileMode)
+}
+
+// writeFile writes a file with mode, as created by createFile.
+func writeFile(name string, data []byte, mode os.FileMode) error {
+	f, err := createFile(name, mode)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// treeFileMode returns the mode of the output file for f with
+// -mode-from-tree: executable for the files that are executable in the
+// tree, and the default mode for all others.
+func treeFileMode(f *object.File) os.FileMode {
+	if f.Mode == filemode.Executable {
+		return executableFileMode
+	}
+	return defaultFileMode
+}
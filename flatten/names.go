@@ -0,0 +1,132 @@
+package flatten
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxFileNameLen is the file name length limit, in bytes, shared by the
+// common file systems.
+const maxFileNameLen = 255
+
+// safeFileName shortens name when it would exceed maxFileNameLen. The
+// extension is kept and a short hash of the full name is appended to the
+// truncated stem, so distinct long names stay distinct. Truncations are
+// reported on stderr.
+func safeFileName(name string) string {
+	if len(name) <= maxFileNameLen {
+		return name
+	}
+
+	ext := path.Ext(name)
+	if len(ext) > 16 {
+		ext = ""
+	}
+	suffix := "-" + shortHash(name) + ext
+
+	stem := name[:maxFileNameLen-len(suffix)]
+	for !utf8.ValidString(stem) {
+		stem = stem[:len(stem)-1]
+	}
+
+	short := stem + suffix
+	warnf("Truncated file name %q to %q\n", name, short)
+	return short
+}
+
+// shortHash returns 8 hex digits of the SHA-256 of s.
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
+
+// flatNamer names the files of a flat output, where files from different
+// directories can share a base name. The strategies are:
+//
+//   - overwrite: use the base name; later files replace earlier ones.
+//   - suffix: the first file keeps its base name and later ones get a hash
+//     of their full path added to the stem.
+//   - path: use the full path with slashes replaced by underscores.
+//   - hash: every file gets a short hash of its full path added to the
+//     stem, e.g. main.3f9a2c.go, so a name never depends on the other
+//     files.
+//
+// Files reach the namer in tree order whatever -jobs is, and suffixes come
+// from the path rather than a counter, so a tree always gets the same
+// names.
+type flatNamer struct {
+	strategy string
+	// owners maps the names handed out so far to the paths they were
+	// handed to.
+	owners map[string]string
+}
+
+func newFlatNamer(strategy string) *flatNamer {
+	return &flatNamer{strategy: strategy, owners: make(map[string]string)}
+}
+
+// name returns the output file name for the file at the repository path
+// name.
+func (n *flatNamer) name(name string) string {
+	out := path.Base(name)
+	switch n.strategy {
+	case "path":
+		out = strings.ReplaceAll(name, "/", "_")
+	case "hash":
+		ext := path.Ext(out)
+		out = strings.TrimSuffix(out, ext) + "." + shortHash(name)[:6] + ext
+	case "suffix":
+		if owner, ok := n.owners[out]; ok && owner != name {
+			ext := path.Ext(out)
+			out = strings.TrimSuffix(out, ext) + "-" + shortHash(name) + ext
+		}
+	}
+	n.owners[out] = name
+	return safeFileName(out)
+}
+
+// displayPath returns the path shown for a file in headers and other
+// output. Selection always uses the full repo-relative name.
+func displayPath(name string, opts *Options) string {
+	if opts.RelativeTo != "" && strings.HasPrefix(name, opts.RelativeTo+"/") {
+		name = strings.TrimPrefix(name, opts.RelativeTo+"/")
+	}
+	for _, rule := range opts.Rewrites {
+		name = rule.apply(name)
+	}
+	return name
+}
+
+// rewriteRule replaces the directory prefix From of displayed paths with
+// To, e.g. internal=core shows internal/db/db.go as core/db/db.go.
+type rewriteRule struct {
+	From, To string
+}
+
+func parseRewrites(specs []string) ([]rewriteRule, error) {
+	var rules []rewriteRule
+	for _, spec := range specs {
+		from, to, ok := strings.Cut(spec, "=")
+		from, to = strings.Trim(from, "/"), strings.Trim(to, "/")
+		if !ok || from == "" {
+			return nil, fmt.Errorf("invalid rewrite %q: expected from=to", spec)
+		}
+		rules = append(rules, rewriteRule{From: from, To: to})
+	}
+	return rules, nil
+}
+
+func (r rewriteRule) apply(name string) string {
+	if name != r.From && !strings.HasPrefix(name, r.From+"/") {
+		return name
+	}
+	rest := strings.TrimPrefix(name, r.From)
+	if r.To == "" {
+		return strings.TrimPrefix(rest, "/")
+	}
+	return r.To + rest
+}
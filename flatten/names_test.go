@@ -0,0 +1,173 @@
+package flatten
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// testRepo commits files, keyed by path, to a new repository in a
+// temporary directory and returns it with the tree of that commit.
+func testRepo(t *testing.T, files map[string]string) (*git.Repository, *object.Tree) {
+	t.Helper()
+
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		full := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := wt.Add(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hash, err := wt.Commit("test", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Unix(0, 0)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo, tree
+}
+
+// collidingFiles are files of which several share a base name.
+var collidingFiles = map[string]string{
+	"main.go":                "package main\n",
+	"cmd/main.go":            "package main\n",
+	"cmd/tool/main.go":       "package main\n",
+	"internal/main.go":       "package internal\n",
+	"README.md":              "# top\n",
+	"docs/README.md":         "# docs\n",
+	"docs/guide/README.md":   "# guide\n",
+	"pkg/util/util.go":       "package util\n",
+	"pkg/other/util.go":      "package other\n",
+	"pkg/other/util_test.go": "package other\n",
+}
+
+var collisionStrategies = []string{"overwrite", "suffix", "path", "hash"}
+
+func TestFlatNamerStable(t *testing.T) {
+	paths := []string{"main.go", "cmd/main.go", "internal/main.go", "README.md", "docs/README.md"}
+
+	for _, strategy := range collisionStrategies {
+		t.Run(strategy, func(t *testing.T) {
+			var want []string
+			for run := 0; run < 5; run++ {
+				namer := newFlatNamer(strategy)
+				var got []string
+				for _, p := range paths {
+					got = append(got, namer.name(p))
+				}
+				if want == nil {
+					want = got
+					continue
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("run %d: names %q, want %q", run, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFlatNamerHashIgnoresOtherFiles(t *testing.T) {
+	alone := newFlatNamer("hash").name("cmd/main.go")
+
+	namer := newFlatNamer("hash")
+	namer.name("main.go")
+	namer.name("internal/main.go")
+	if got := namer.name("cmd/main.go"); got != alone {
+		t.Errorf("name with other files = %q, alone = %q", got, alone)
+	}
+}
+
+func TestFlatNamesAcrossJobs(t *testing.T) {
+	repo, tree := testRepo(t, collidingFiles)
+
+	for _, strategy := range collisionStrategies {
+		t.Run(strategy, func(t *testing.T) {
+			var want []string
+			for _, jobs := range []int{1, 2, 8, 32} {
+				for run := 0; run < 3; run++ {
+					namer := newFlatNamer(strategy)
+					var got []string
+					opts := &Options{Jobs: jobs, Quiet: true}
+					err := processFiles(context.Background(), repo, tree, opts, func(f *object.File, _ string) error {
+						got = append(got, f.Name+" -> "+namer.name(f.Name))
+						return nil
+					})
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(got) != len(collidingFiles) {
+						t.Fatalf("-jobs %d: named %d files, want %d", jobs, len(got), len(collidingFiles))
+					}
+					if want == nil {
+						want = got
+						continue
+					}
+					if !reflect.DeepEqual(got, want) {
+						t.Fatalf("-jobs %d, run %d: names\n%q\nwant\n%q", jobs, run, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestZipEntriesUnique(t *testing.T) {
+	repo, _ := testRepo(t, collidingFiles)
+
+	for _, strategy := range collisionStrategies {
+		t.Run(strategy, func(t *testing.T) {
+			var buf bytes.Buffer
+			opts := &Options{Jobs: 4, Quiet: true, CollisionStrategy: strategy, repo: repo}
+			if err := flattenToZip(context.Background(), &buf, opts); err != nil {
+				t.Fatal(err)
+			}
+
+			zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen := make(map[string]bool)
+			for _, f := range zr.File {
+				if seen[f.Name] {
+					t.Errorf("duplicate entry %s", f.Name)
+				}
+				seen[f.Name] = true
+			}
+			if len(seen) != len(collidingFiles) {
+				t.Errorf("%d entries, want %d", len(seen), len(collidingFiles))
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package flatten
+
+import "strings"
+
+// markupExts are the extensions of files that take an HTML-style comment
+// for -path-comments.
+var markupExts = map[string]bool{
+	".html": true, ".htm": true, ".xml": true, ".svg": true, ".vue": true,
+}
+
+// withPathComment returns content with a comment naming the file's
+// repository path added at the top, written in the comment syntax of the
+// file's language, for -path-comments. A shebang or XML declaration has
+// to stay on the first line, so the comment goes after it. Files of
+// languages without comments, such as JSON, are returned unchanged.
+func withPathComment(name, content string) string {
+	ext := syntaxExt(name, func(ext string) bool {
+		_, ok := commentSyntaxes[ext]
+		return ok || markupExts[ext]
+	})
+
+	var comment string
+	switch syntax, ok := commentSyntaxes[ext]; {
+	case ok && syntax.line != "":
+		comment = syntax.line + " Path: " + name
+	case ok:
+		comment = syntax.blockStart + " Path: " + name + " " + syntax.blockEnd
+	case markupExts[ext]:
+		comment = "<!-- Path: " + name + " -->"
+	default:
+		return content
+	}
+
+	if strings.HasPrefix(content, "#!") || strings.HasPrefix(content, "<?xml") {
+		first, rest, _ := strings.Cut(content, "\n")
+		return first + "\n" + comment + "\n" + rest
+	}
+	return comment + "\n" + content
+}
@@ -0,0 +1,211 @@
+package flatten
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// flattenPerDir concatenates the selected files of every source directory
+// into a single file per directory, named after the directory path. With
+// -per-toplevel, a directory takes in its whole subtree and only top-level
+// directories get a file, and -split-by-toplevel adds an index of them.
+func flattenPerDir(ctx context.Context, opts *Options) error {
+	repo, err := cloneRepo(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	tree, err := targetTree(repo, opts.Ref)
+	if err != nil {
+		return err
+	}
+
+	err = createDest(opts)
+	if err != nil {
+		return err
+	}
+
+	// Tree order interleaves the files of a directory with those of its
+	// subdirectories, so every output takes writes until the walk is done.
+	// They are buffered and appended to their file in batches, which keeps
+	// a single file open at a time however many directories there are.
+	outputs := make(map[string]*dirOutput)
+	// names maps the output file names handed out to their directories.
+	names := make(map[string]string)
+
+	err = processFiles(ctx, repo, tree, opts, func(f *object.File, content string) error {
+		dir := outputDir(f.Name, opts)
+		out, ok := outputs[dir]
+		if !ok {
+			format := newFormatter(opts)
+			name := uniqueDirFileName(dir, outputDir(displayPath(f.Name, opts), opts), format.ext(), names)
+			file, err := createOutput(filepath.Join(opts.DestFolder, name), opts)
+			if err != nil {
+				return err
+			}
+			out = &dirOutput{path: file.Name(), format: format, name: filepath.Base(file.Name())}
+			outputs[dir] = out
+			if err := file.Close(); err != nil {
+				return err
+			}
+
+			err = format.begin(&out.buf)
+			if err != nil {
+				return err
+			}
+		}
+		out.files++
+		err := out.format.file(&out.buf, displayPath(f.Name, opts), content)
+		if err != nil {
+			return err
+		}
+		if out.buf.Len() >= dirFlushSize {
+			return out.flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error processing files: %w", err)
+	}
+
+	var index []topLevelEntry
+	for _, out := range outputs {
+		err := out.format.end(&out.buf)
+		if err == nil {
+			err = out.flush()
+		}
+		if err != nil {
+			return fmt.Errorf("error writing output file: %w", err)
+		}
+		info, err := os.Stat(out.path)
+		if err != nil {
+			return fmt.Errorf("error writing output file: %w", err)
+		}
+		index = append(index, topLevelEntry{name: out.name, files: out.files, size: info.Size()})
+	}
+
+	if opts.TopLevelIndex {
+		return writeTopLevelIndex(index, opts)
+	}
+	return nil
+}
+
+// dirFlushSize is how much output of a directory is buffered before it is
+// appended to its file.
+const dirFlushSize = 64 << 10
+
+// dirOutput is the output of a single source directory. Its formatter
+// writes to buf, which flush appends to the file at path.
+type dirOutput struct {
+	path   string
+	buf    bytes.Buffer
+	format formatter
+	name   string
+	files  int
+}
+
+// flush appends the buffered output to the file.
+func (o *dirOutput) flush() error {
+	if o.buf.Len() == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(o.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	_, err = o.buf.WriteTo(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// topLevelEntry is an output file as listed in the -split-by-toplevel
+// index.
+type topLevelEntry struct {
+	name  string
+	files int
+	size  int64
+}
+
+// writeTopLevelIndex writes index.md with -format markdown, and index.txt
+// otherwise, listing every output file with the number of source files it
+// holds and its size. If a top-level directory already took that name, the
+// index is written with a leading underscore instead.
+func writeTopLevelIndex(entries []topLevelEntry, opts *Options) error {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	name, heading, item := "index.txt", "Index:", "  %s"
+	if opts.Format == "markdown" {
+		name, heading, item = "index.md", "# Index\n", "- [`%[1]s`](%[1]s)"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", heading)
+	for _, entry := range entries {
+		if entry.name == name {
+			name = "_" + name
+		}
+		fmt.Fprintf(&b, item, entry.name)
+		fmt.Fprintf(&b, " (%d file(s), %d bytes)\n", entry.files, entry.size)
+	}
+
+	err := writeOutput(filepath.Join(opts.DestFolder, name), []byte(b.String()), opts)
+	if err != nil {
+		return fmt.Errorf("error writing index: %w", err)
+	}
+	return nil
+}
+
+// outputDir returns the directory whose output file the file name is
+// written to: its top-level directory with -per-toplevel, and its own
+// directory otherwise. Both are "." for files at the root.
+func outputDir(name string, opts *Options) string {
+	if !opts.PerTopLevel {
+		return path.Dir(name)
+	}
+	top, _, ok := strings.Cut(name, "/")
+	if !ok {
+		return "."
+	}
+	return top
+}
+
+// uniqueDirFileName returns the output file name of dir, shown as shown,
+// and records it in taken. When another directory already has the name,
+// as cmd_server has that of cmd/server and a root directory that of the
+// files at the root, a short hash of dir is added to it, so an open
+// output is never truncated by another.
+func uniqueDirFileName(dir, shown, ext string, taken map[string]string) string {
+	name := dirFileName(shown, ext)
+	if owner, ok := taken[name]; ok && owner != dir {
+		unique := safeFileName(strings.TrimSuffix(name, ext) + "-" + shortHash(dir) + ext)
+		label := dir
+		if dir == "." {
+			label = "the files at the root"
+		}
+		warnf("Wrote %s to %s, as %s is taken by %s\n", label, unique, name, owner)
+		name = unique
+	}
+	taken[name] = dir
+	return name
+}
+
+// dirFileName returns the output file name for a repo-relative directory,
+// e.g. "cmd/server" becomes "cmd_server.txt". Files at the repository root
+// go to "root.txt".
+func dirFileName(dir, ext string) string {
+	if dir == "." || dir == "" {
+		return "root" + ext
+	}
+	return safeFileName(strings.ReplaceAll(dir, "/", "_") + ext)
+}
@@ -0,0 +1,190 @@
+package flatten
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// transforms are the steps available to the per-extension pipelines of
+// the config file's "transforms" section.
+var transforms = map[string]func(name, content string) string{
+	"strip-comments": stripComments,
+	"minify":         minify,
+	"dedent":         func(_, content string) string { return dedent(content) },
+	"trim":           func(_, content string) string { return trimLines(content) },
+	"squeeze-blank":  func(_, content string) string { return squeezeBlank(content) },
+	"strip-blank":    func(_, content string) string { return stripBlank(content) },
+}
+
+// parseTransforms checks the pipelines of the config file and keys them by
+// lower-case extension with a leading dot.
+func parseTransforms(pipelines map[string][]string) (map[string][]string, error) {
+	parsed := make(map[string][]string, len(pipelines))
+	for ext, steps := range pipelines {
+		for _, step := range steps {
+			if transforms[step] == nil {
+				return nil, fmt.Errorf("unknown transform %q for %s (available: %s)", step, ext, strings.Join(transformNames(), ", "))
+			}
+		}
+		parsed["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = steps
+	}
+	return parsed, nil
+}
+
+func transformNames() []string {
+	var names []string
+	for name := range transforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runPipeline applies the pipeline configured for the extension of name.
+func runPipeline(name, content string, pipelines map[string][]string) string {
+	for _, step := range pipelines[strings.ToLower(path.Ext(name))] {
+		content = transforms[step](name, content)
+	}
+	return content
+}
+
+// trimLines removes trailing whitespace from every line and blank lines
+// from the start and end of content.
+func trimLines(content string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n") + "\n"
+}
+
+// commentSyntax describes the comments and string literals of a language
+// family, as far as stripComments needs to know them.
+type commentSyntax struct {
+	line         string
+	blockStart   string
+	blockEnd     string
+	quotes       string
+	rawBacktick  bool
+	tripleQuotes bool
+}
+
+var (
+	cSyntax      = commentSyntax{line: "//", blockStart: "/*", blockEnd: "*/", quotes: `"'`}
+	goSyntax     = commentSyntax{line: "//", blockStart: "/*", blockEnd: "*/", quotes: `"'`, rawBacktick: true}
+	jsSyntax     = commentSyntax{line: "//", blockStart: "/*", blockEnd: "*/", quotes: `"'`, rawBacktick: true}
+	cssSyntax    = commentSyntax{blockStart: "/*", blockEnd: "*/", quotes: `"'`}
+	hashSyntax   = commentSyntax{line: "#", quotes: `"'`}
+	pythonSyntax = commentSyntax{line: "#", quotes: `"'`, tripleQuotes: true}
+	// Rust and Swift use ' for lifetimes and other things besides
+	// character literals, so only double quotes delimit strings.
+	rustSyntax = commentSyntax{line: "//", blockStart: "/*", blockEnd: "*/", quotes: `"`}
+)
+
+var commentSyntaxes = map[string]commentSyntax{
+	".go": goSyntax,
+	".c":  cSyntax, ".h": cSyntax, ".cc": cSyntax, ".cpp": cSyntax, ".cxx": cSyntax, ".hpp": cSyntax,
+	".java": cSyntax, ".kt": cSyntax, ".scala": cSyntax, ".cs": cSyntax, ".dart": cSyntax, ".proto": cSyntax,
+	".js": jsSyntax, ".mjs": jsSyntax, ".cjs": jsSyntax, ".jsx": jsSyntax, ".ts": jsSyntax, ".tsx": jsSyntax,
+	".css": cssSyntax, ".scss": cSyntax, ".less": cSyntax,
+	".rs": rustSyntax, ".swift": rustSyntax,
+	".py": pythonSyntax,
+	".sh": hashSyntax, ".bash": hashSyntax, ".zsh": hashSyntax, ".rb": hashSyntax, ".pl": hashSyntax,
+	".yaml": hashSyntax, ".yml": hashSyntax, ".toml": hashSyntax, ".r": hashSyntax,
+}
+
+// stripComments removes comments from source files of the languages in
+// commentSyntaxes and returns other content unchanged. String literals are
+// tracked so comment markers inside them are kept. Lines that held nothing
+// but a comment are dropped, and a shebang line is kept.
+func stripComments(name, content string) string {
+	syntax, ok := commentSyntaxes[syntaxExt(name, func(ext string) bool {
+		_, ok := commentSyntaxes[ext]
+		return ok
+	})]
+	if !ok {
+		return content
+	}
+
+	var out strings.Builder
+	quote := ""
+	inBlock := false
+	lines := strings.Split(content, "\n")
+	for n, line := range lines {
+		if n == 0 && strings.HasPrefix(line, "#!") {
+			out.WriteString(line)
+			if len(lines) > 1 {
+				out.WriteByte('\n')
+			}
+			continue
+		}
+
+		var b strings.Builder
+		hadComment := inBlock
+		for i := 0; i < len(line); {
+			rest := line[i:]
+			switch {
+			case inBlock:
+				end := strings.Index(rest, syntax.blockEnd)
+				if end < 0 {
+					i = len(line)
+					continue
+				}
+				inBlock = false
+				i += end + len(syntax.blockEnd)
+			case quote != "":
+				if rest[0] == '\\' && quote != "`" && len(rest) > 1 {
+					b.WriteString(rest[:2])
+					i += 2
+					continue
+				}
+				if strings.HasPrefix(rest, quote) {
+					b.WriteString(quote)
+					i += len(quote)
+					quote = ""
+					continue
+				}
+				b.WriteByte(rest[0])
+				i++
+			case syntax.line != "" && strings.HasPrefix(rest, syntax.line):
+				hadComment = true
+				i = len(line)
+			case syntax.blockStart != "" && strings.HasPrefix(rest, syntax.blockStart):
+				hadComment = true
+				inBlock = true
+				i += len(syntax.blockStart)
+			case syntax.tripleQuotes && (strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, `'''`)):
+				quote = rest[:3]
+				b.WriteString(quote)
+				i += 3
+			case strings.IndexByte(syntax.quotes, rest[0]) >= 0 || (syntax.rawBacktick && rest[0] == '`'):
+				quote = rest[:1]
+				b.WriteString(quote)
+				i++
+			default:
+				b.WriteByte(rest[0])
+				i++
+			}
+		}
+		// Ordinary quotes do not span lines, except for the raw and
+		// triple-quoted strings.
+		if len(quote) == 1 && quote != "`" {
+			quote = ""
+		}
+
+		stripped := b.String()
+		if hadComment && strings.TrimSpace(stripped) == "" && quote == "" {
+			continue
+		}
+		if hadComment {
+			stripped = strings.TrimRight(stripped, " \t")
+		}
+		out.WriteString(stripped)
+		if n < len(lines)-1 {
+			out.WriteByte('\n')
+		}
+	}
+	return out.String()
+}
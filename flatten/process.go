@@ -0,0 +1,745 @@
+package flatten
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// fileJob is a selected file moving through the processing pipeline.
+type fileJob struct {
+	seq      int
+	file     *object.File
+	content  string
+	redacted int
+	// blame is the -blame-summary line for the file.
+	blame string
+	// saved is the number of bytes removed by -minify.
+	saved int
+	// importsSaved is the number of bytes removed by -strip-imports.
+	importsSaved int
+	// err is set when -filter-cmd failed for the file.
+	err error
+}
+
+// processFiles selects the files of tree that pass the filters in opts and
+// calls write for each of them, in tree order.
+//
+// Selection and reading happen on a single goroutine, since go-git's
+// storage is not safe for concurrent use. Content transformations run on
+// opts.Jobs workers, and a reorder buffer hands the results to write in
+// the original order, so the output does not depend on scheduling.
+func processFiles(ctx context.Context, repo *git.Repository, tree *object.Tree, opts *Options, write func(f *object.File, content string) error) error {
+	root := tree
+
+	if opts.MaxTreeFiles > 0 && !opts.Force {
+		err := checkTreeSize(tree, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	var added map[string]bool
+	if opts.AddedSince != "" {
+		var err error
+		added, err = addedFiles(repo, tree, opts.AddedSince)
+		if err != nil {
+			return err
+		}
+	}
+
+	var changed map[string]*object.Change
+	if opts.ChangedSince != "" || opts.MergeBase != "" {
+		base := opts.ChangedSince
+		if opts.MergeBase != "" {
+			commit, err := mergeBase(repo, opts.Ref, opts.MergeBase)
+			if err != nil {
+				return err
+			}
+			infof("Comparing with the merge base of %s and %s, %s\n", refOrHead(opts.Ref), opts.MergeBase, commit.Hash)
+			opts.log().Info("merge base resolved", "ref", refOrHead(opts.Ref), "other", opts.MergeBase, "commit", commit.Hash.String())
+			base = commit.Hash.String()
+		}
+
+		var err error
+		changed, err = changedFiles(repo, tree, base)
+		if err != nil {
+			return err
+		}
+	}
+
+	var ignored gitignore.Matcher
+	if opts.RespectGitignore {
+		var err error
+		ignored, err = ignoreMatcher(tree, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	var recent map[string]bool
+	var cutoff time.Time
+	if opts.SinceDays > 0 || !opts.RecencySince.IsZero() {
+		commit, err := targetCommit(repo, opts.Ref)
+		if err != nil {
+			return err
+		}
+		cutoff = opts.RecencySince
+		if opts.SinceDays > 0 {
+			cutoff = time.Now().AddDate(0, 0, -opts.SinceDays)
+		}
+		recent, err = changedSince(repo, commit, cutoff)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Walking only the subpath's tree means blobs outside of it are never
+	// read. Names are made repo-relative again so the other filters behave
+	// the same with or without a subpath.
+	if opts.Subpath != "" {
+		subtree, err := tree.Tree(opts.Subpath)
+		if err != nil {
+			return fmt.Errorf("error finding subpath %s: %w", opts.Subpath, err)
+		}
+		tree = subtree
+	}
+
+	// The history is read on the walking goroutine, as it uses the
+	// repository's storage too.
+	var head *object.Commit
+	if opts.BlameSummary {
+		var err error
+		head, err = targetCommit(repo, opts.Ref)
+		if err != nil {
+			return err
+		}
+	}
+
+	log := opts.log()
+	skip := func(f *object.File, reason string) error {
+		log.Info("file skipped", "path", f.Name, "reason", reason)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := max(opts.Jobs, 1)
+	jobs := make(chan *fileJob, workers)
+	results := make(chan *fileJob, workers)
+
+	// Per-file errors collected with -continue-on-error. The walk and the
+	// writer run on different goroutines, so each keeps its own list.
+	var readErrs, writeErrs []error
+
+	selected := 0
+	// read returns the contents of f. With -continue-on-error a file that
+	// cannot be read is reported and ok is false.
+	read := func(f *object.File) (content string, ok bool, err error) {
+		if opts.IncludeWorktree {
+			var data []byte
+			data, err = os.ReadFile(filepath.Join(opts.RepoURL, filepath.FromSlash(f.Name)))
+			if errors.Is(err, fs.ErrNotExist) {
+				infof("Skipped %s: it was deleted in the working tree\n", f.Name)
+				return "", false, skip(f, "deleted in worktree")
+			}
+			content = string(data)
+		} else {
+			content, err = f.Contents()
+		}
+		if err != nil {
+			log.Error("error reading file", "path", f.Name, "error", err)
+			err = fmt.Errorf("error reading %s: %w", f.Name, err)
+			if opts.ContinueOnError {
+				errorf("%v\n", err)
+				readErrs = append(readErrs, err)
+				return "", false, nil
+			}
+			return "", false, err
+		}
+		return content, true, nil
+	}
+
+	send := func(f *object.File, content string) error {
+		job := &fileJob{seq: selected, file: f, content: content}
+		if head != nil {
+			var err error
+			job.blame, err = blameSummary(repo, head, f.Name)
+			if err != nil {
+				return err
+			}
+		}
+
+		select {
+		case jobs <- job:
+			selected++
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	enqueue := func(f *object.File) error {
+		if opts.pathsOnly() {
+			return send(f, "")
+		}
+		content, ok, err := read(f)
+		if !ok {
+			return err
+		}
+		return send(f, content)
+	}
+
+	var listed *fileList
+	if len(opts.FileList) > 0 {
+		listed = newFileList(opts.FileList)
+	}
+
+	lfsSkipped := 0
+	generated := 0
+	resolvedLinks, rejectedLinks := 0, 0
+	pins := pinnedFiles(root, opts)
+	pinned := make(map[string]bool)
+	// pathSkip returns why f is skipped by the filters that only look at
+	// its path and size, or "" when it passes them.
+	pathSkip := func(f *object.File) string {
+		switch {
+		case added != nil && !added[f.Name]:
+			return "not added"
+		case recent != nil && !recent[f.Name]:
+			return "not changed recently"
+		case changed != nil && changed[f.Name] == nil:
+			return "not changed"
+		case listed != nil && !listed.match(f.Name):
+			return "not in file list"
+		case ignored != nil && ignored.Match(strings.Split(f.Name, "/"), false):
+			return "gitignored"
+		case shouldExclude(f.Name, opts.ExcludeDirs, opts.Include):
+			return "excluded"
+		case opts.SkipHidden && isHidden(f.Name, opts.Include):
+			return "hidden"
+		case !hasValidExtension(f.Name, opts.Extensions):
+			return "extension"
+		// The size comes from the blob header, so oversized files are
+		// skipped without ever being read or decompressed.
+		case opts.MaxSize > 0 && f.Size > opts.MaxSize:
+			return "too large"
+		case opts.ExcludeGenerated && isGeneratedName(f.Name):
+			generated++
+			return "generated"
+		}
+		return ""
+	}
+
+	visit := func(f *object.File) error {
+		if opts.MaxFiles > 0 && selected >= opts.MaxFiles {
+			log.Info("file limit reached", "max_files", opts.MaxFiles)
+			return storer.ErrStop
+		}
+
+		if pinned[f.Name] {
+			return nil
+		}
+
+		if reason := pathSkip(f); reason != "" {
+			return skip(f, reason)
+		}
+
+		// Listing stops short of reading the file, so the filters that
+		// look at its content below do not apply.
+		if opts.pathsOnly() {
+			return send(f, "")
+		}
+
+		// A resolved symlink is included under its own path, with the
+		// content of its target.
+		source := f
+		if opts.ResolveSymlinks && f.Mode == filemode.Symlink {
+			target, err := resolveSymlink(root, f)
+			if err != nil {
+				warnf("Not following symlink %s: %v\n", f.Name, err)
+				rejectedLinks++
+				return skip(f, "symlink rejected")
+			}
+			resolvedLinks++
+			source = target
+		}
+
+		content, ok, err := read(source)
+		if !ok {
+			return err
+		}
+
+		if pointer, ok := parseLFSPointer(content); ok {
+			switch {
+			case opts.FetchLFS:
+				// The blob is only a pointer, so -max-size is checked
+				// against the size of the object it points to.
+				if opts.MaxSize > 0 && pointer.Size > opts.MaxSize {
+					return skip(f, "too large")
+				}
+				content, err = fetchLFSObject(ctx, opts, pointer)
+				if err != nil {
+					return err
+				}
+			case opts.SkipLFS:
+				lfsSkipped++
+				return skip(f, "lfs pointer")
+			}
+		}
+
+		if opts.ExcludeGenerated && hasGeneratedHeader(content) {
+			generated++
+			return skip(f, "generated")
+		}
+
+		if len(opts.ContentTypes) > 0 && !matchesContentType(content, opts.ContentTypes) {
+			return skip(f, "content type")
+		}
+
+		if opts.MaxLineLength > 0 && hasLongLine(content, opts.MaxLineLength) {
+			infof("Skipped %s: it has lines longer than %d characters\n", f.Name, opts.MaxLineLength)
+			return skip(f, "long lines")
+		}
+
+		if opts.HunksOnly {
+			content, err = changeHunks(changed[f.Name], f.Name)
+			if err != nil {
+				return err
+			}
+			if content == "" {
+				return skip(f, "no hunks")
+			}
+		}
+
+		return send(f, content)
+	}
+
+	prog := newProgress(opts)
+
+	var walkErr error
+	go func() {
+		defer close(jobs)
+		defer func() { prog.setTotal(selected) }()
+
+		// Pinned files lead the output and bypass the filters.
+		for _, name := range pins {
+			f, err := root.File(name)
+			if err != nil {
+				warnf("Pinned file %s was not found\n", name)
+				continue
+			}
+			walkErr = enqueue(f)
+			if walkErr != nil {
+				return
+			}
+			pinned[name] = true
+		}
+
+		// Breadth-first traversal and -sort go-deps need every path before
+		// the first file can be selected, so the walk only collects them.
+		// Files the path filters reject are dropped right away, so -sort
+		// go-deps never reads them, except go.mod files below the size
+		// limit, which it needs to resolve import paths.
+		walk := visit
+		var queued []*object.File
+		if opts.Traversal == "bfs" || opts.Sort == "go-deps" {
+			walk = func(f *object.File) error {
+				if pinned[f.Name] {
+					return nil
+				}
+				reason := pathSkip(f)
+				if reason != "" && (reason == "too large" || path.Base(f.Name) != "go.mod") {
+					return skip(f, reason)
+				}
+				queued = append(queued, f)
+				return nil
+			}
+		}
+
+		walkErr = tree.Files().ForEach(func(f *object.File) error {
+			if opts.Subpath != "" {
+				f.Name = path.Join(opts.Subpath, f.Name)
+			}
+			return walk(f)
+		})
+		if walkErr == nil && opts.SubmoduleContents && (opts.MaxFiles <= 0 || selected < opts.MaxFiles) {
+			walkErr = processSubmodules(ctx, root, opts.RepoURL, "", opts, walk)
+		}
+		if walkErr == nil && queued != nil && opts.Sort == "go-deps" {
+			ordered, cycles := sortGoDeps(queued)
+			if cycles > 0 {
+				warnf("-sort go-deps broke %d import cycle(s); the packages involved are in tree order\n", cycles)
+			}
+			walkErr = visitInOrder(ordered, visit)
+		} else if walkErr == nil && queued != nil {
+			walkErr = visitBreadthFirst(queued, visit)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				transformFile(ctx, job, opts)
+				results <- job
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	count := 0
+	minified, saved := 0, 0
+	stripped, importsSaved := 0, 0
+	var sizes []fileSize
+	var tokens []fileTokens
+	seen := make(map[string]bool)
+	emit := func(job *fileJob) error {
+		f, content := job.file, job.content
+		if job.err != nil {
+			log.Error("error filtering file", "path", f.Name, "error", job.err)
+			err := fmt.Errorf("error filtering %s: %w", f.Name, job.err)
+			if opts.ContinueOnError {
+				errorf("%v\n", err)
+				writeErrs = append(writeErrs, err)
+				return nil
+			}
+			return err
+		}
+		if job.redacted > 0 {
+			infof("Redacted %d secret(s) in %s\n", job.redacted, f.Name)
+			log.Info("secrets redacted", "path", f.Name, "count", job.redacted)
+		}
+
+		// The blame line goes on top of what is written, so it does not
+		// shift the line numbers of -ranges.
+		writeFile := write
+		if job.blame != "" {
+			line := blameLine(job.blame, opts)
+			writeFile = func(f *object.File, content string) error {
+				return write(f, line+"\n"+content)
+			}
+		}
+
+		var err error
+		if fileRanges := opts.Ranges[f.Name]; fileRanges != nil {
+			err = writeRanges(f, content, fileRanges, writeFile)
+		} else {
+			err = writeFile(f, content)
+		}
+		if err != nil {
+			log.Error("error writing file", "path", f.Name, "error", err)
+			err = fmt.Errorf("error writing %s: %w", f.Name, err)
+			if opts.ContinueOnError {
+				errorf("%v\n", err)
+				writeErrs = append(writeErrs, err)
+				return nil
+			}
+			return err
+		}
+		log.Info("file included", "path", f.Name, "size", len(content))
+		if job.saved > 0 {
+			minified++
+			saved += job.saved
+		}
+		if job.importsSaved > 0 {
+			stripped++
+			importsSaved += job.importsSaved
+		}
+		count++
+		seen[f.Name] = true
+		if opts.SourceHash != nil {
+			hashFile(opts.SourceHash, displayPath(f.Name, opts), content)
+		}
+		if opts.ReportLargest > 0 {
+			sizes = append(sizes, fileSize{name: f.Name, size: len(content)})
+		}
+		if opts.TokensPerFile != "" {
+			tokens = append(tokens, fileTokens{Path: f.Name, Tokens: estimateTokens(content)})
+		}
+		prog.step()
+		return nil
+	}
+
+	// Results arrive in completion order; hold them back until every
+	// earlier file has been written.
+	var err error
+	pending := make(map[int]*fileJob)
+	next := 0
+	for job := range results {
+		if err != nil {
+			continue
+		}
+		pending[job.seq] = job
+		for pending[next] != nil && err == nil {
+			job := pending[next]
+			delete(pending, next)
+			next++
+			err = emit(job)
+		}
+		if err != nil {
+			cancel()
+		}
+	}
+	prog.finish()
+	if err != nil {
+		return err
+	}
+	if walkErr != nil {
+		return walkErr
+	}
+	log.Info("files processed", "included", count)
+
+	for name := range opts.Ranges {
+		if !seen[name] {
+			warnf("Range file %s was not found or was filtered out\n", name)
+		}
+	}
+
+	if listed != nil {
+		for _, name := range listed.paths {
+			if !seen[name] {
+				warnf("File %s from the %s was not found or was filtered out\n", name, opts.FileListSource)
+			}
+		}
+		for _, pattern := range listed.unmatched() {
+			warnf("Pattern %s in the %s matched no files\n", pattern, opts.FileListSource)
+		}
+	}
+
+	if opts.ReportLargest > 0 {
+		reportLargest(sizes, opts.ReportLargest)
+	}
+
+	if opts.TokensPerFile != "" {
+		err := reportTokens(os.Stderr, tokens, opts.TokensPerFile)
+		if err != nil {
+			return fmt.Errorf("error writing token report: %w", err)
+		}
+	}
+
+	if lfsSkipped > 0 {
+		infof("Skipped %d Git LFS pointer file(s); use -fetch-lfs to include their objects\n", lfsSkipped)
+		log.Info("lfs pointers skipped", "count", lfsSkipped)
+	}
+
+	if opts.ResolveSymlinks {
+		infof("Resolved %d symlink(s), rejected %d\n", resolvedLinks, rejectedLinks)
+		log.Info("symlinks resolved", "resolved", resolvedLinks, "rejected", rejectedLinks)
+	}
+
+	if opts.ExcludeGenerated {
+		infof("Excluded %d generated file(s)\n", generated)
+		log.Info("generated files excluded", "count", generated)
+	}
+
+	if opts.StripImports {
+		infof("Stripped imports from %d file(s), saving %d bytes\n", stripped, importsSaved)
+		log.Info("imports stripped", "count", stripped, "bytes_saved", importsSaved)
+	}
+
+	if opts.Minify {
+		infof("Minified %d file(s), saving %d bytes\n", minified, saved)
+		log.Info("files minified", "count", minified, "bytes_saved", saved)
+	}
+
+	if added != nil {
+		infof("Selected %d file(s) added since %s\n", count, opts.AddedSince)
+	}
+
+	if changed != nil {
+		if opts.MergeBase != "" {
+			infof("Selected %d file(s) changed since the merge base with %s\n", count, opts.MergeBase)
+		} else {
+			infof("Selected %d file(s) changed since %s\n", count, opts.ChangedSince)
+		}
+	}
+
+	if recent != nil && opts.SinceDays > 0 {
+		infof("Selected %d file(s) changed in the last %d day(s), since %s\n", count, opts.SinceDays, cutoff.Format(time.RFC3339))
+	} else if recent != nil {
+		infof("Selected %d file(s) changed since %s\n", count, cutoff.Format(time.RFC3339))
+	}
+
+	if errs := append(readErrs, writeErrs...); len(errs) > 0 {
+		return fmt.Errorf("%d file(s) could not be processed: %w", len(errs), errors.Join(errs...))
+	}
+	return nil
+}
+
+// transformFile applies the content transformations enabled in opts. It
+// only touches the job, so it is safe to run concurrently.
+func transformFile(ctx context.Context, job *fileJob, opts *Options) {
+	if opts.pathsOnly() {
+		return
+	}
+
+	// Binary files written base64-encoded are kept byte for byte, so they
+	// decode back to the original.
+	if opts.BinaryBase64 && isBinary(job.content) {
+		return
+	}
+
+	// The external filter sees the file as it is in the repository, like a
+	// formatter would, before any built-in transform.
+	if len(opts.FilterCmd) > 0 && hasValidExtension(job.file.Name, opts.FilterExts) {
+		content, err := runFilter(ctx, job.file.Name, job.content, opts)
+		if err != nil {
+			job.err = err
+			return
+		}
+		job.content = content
+	}
+
+	if opts.NormalizeUnicode != nil && !isBinary(job.content) {
+		job.content = opts.NormalizeUnicode.String(job.content)
+	}
+
+	if len(opts.Transforms) > 0 {
+		job.content = runPipeline(job.file.Name, job.content, opts.Transforms)
+	}
+
+	if opts.Dedent && opts.concatenated() {
+		job.content = dedent(job.content)
+	}
+
+	if opts.StripImports {
+		before := len(job.content)
+		job.content = stripImports(job.file.Name, job.content)
+		job.importsSaved = before - len(job.content)
+	}
+
+	if opts.Minify {
+		before := len(job.content)
+		job.content = minify(job.file.Name, job.content)
+		job.saved = before - len(job.content)
+	}
+
+	if opts.StripBlank {
+		job.content = stripBlank(job.content)
+	} else if opts.SqueezeBlank {
+		job.content = squeezeBlank(job.content)
+	}
+
+	if opts.Redact {
+		job.content, job.redacted = redact(job.content)
+	}
+
+	if opts.Wrap > 0 && opts.concatenated() {
+		job.content = wrap(job.content, opts.Wrap)
+	}
+}
+
+// writeRanges writes each line range of a file as its own entry, with the
+// range noted next to the file name.
+func writeRanges(f *object.File, content string, ranges []lineRange, write func(f *object.File, content string) error) error {
+	for _, r := range ranges {
+		excerpt, r, ok := extractRange(f.Name, content, r)
+		if !ok {
+			continue
+		}
+
+		part := *f
+		part.Name = fmt.Sprintf("%s (lines %d-%d)", f.Name, r.Start, r.End)
+		err := write(&part, excerpt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readmeNames are the name prefixes of the top-level files pinned by
+// -pin-readme, in the order they are written.
+var readmeNames = []string{"README", "LICENSE", "LICENCE", "COPYING"}
+
+// pinnedFiles returns the paths of the files to write ahead of all others:
+// those given with -pin, then with -pin-readme the README and license
+// files at the top of the repository. Duplicates are dropped.
+func pinnedFiles(root *object.Tree, opts *Options) []string {
+	var pins []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			pins = append(pins, name)
+		}
+	}
+
+	for _, name := range opts.Pins {
+		add(path.Clean(name))
+	}
+
+	if opts.PinReadme {
+		for _, prefix := range readmeNames {
+			for _, entry := range root.Entries {
+				if entry.Mode.IsFile() && strings.HasPrefix(strings.ToUpper(entry.Name), prefix) {
+					add(entry.Name)
+				}
+			}
+		}
+	}
+	return pins
+}
+
+// visitBreadthFirst visits files in order of depth, so the files at the
+// top of the repository come before those in subdirectories. Files at the
+// same depth keep their tree order.
+func visitBreadthFirst(files []*object.File, visit func(f *object.File) error) error {
+	sort.SliceStable(files, func(i, j int) bool {
+		return strings.Count(files[i].Name, "/") < strings.Count(files[j].Name, "/")
+	})
+	return visitInOrder(files, visit)
+}
+
+// visitInOrder visits files in the order given, until visit stops the
+// walk.
+func visitInOrder(files []*object.File, visit func(f *object.File) error) error {
+	for _, f := range files {
+		err := visit(f)
+		if err == storer.ErrStop {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileSize is the size of an included file, for -report-largest.
+type fileSize struct {
+	name string
+	size int
+}
+
+// reportLargest prints the n largest files to stderr.
+func reportLargest(sizes []fileSize, n int) {
+	sort.SliceStable(sizes, func(i, j int) bool { return sizes[i].size > sizes[j].size })
+	sizes = sizes[:min(n, len(sizes))]
+
+	fmt.Fprintf(os.Stderr, "Largest %d included file(s):\n", len(sizes))
+	for _, s := range sizes {
+		fmt.Fprintf(os.Stderr, "  %10d  %s\n", s.size, s.name)
+	}
+}
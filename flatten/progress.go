@@ -0,0 +1,76 @@
+package flatten
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// progressInterval is how often the progress line is redrawn.
+const progressInterval = 100 * time.Millisecond
+
+// progress reports how many of the selected files have been processed on
+// a single, redrawn line. The total is only known once the walk has
+// finished, so until then just the count is shown.
+type progress struct {
+	w       io.Writer
+	enabled bool
+	done    int
+	total   atomic.Int64
+	drawn   time.Time
+	printed bool
+}
+
+// newProgress returns a progress reporter writing to stderr. It stays
+// silent with -quiet or when stderr is not a terminal, so logs and pipes
+// are not filled with redrawn lines.
+func newProgress(opts *Options) *progress {
+	p := &progress{w: os.Stderr, enabled: !opts.Quiet && isTerminal(os.Stderr)}
+	p.total.Store(-1)
+	return p
+}
+
+// setTotal records the number of selected files. It may be called from a
+// different goroutine than step.
+func (p *progress) setTotal(n int) {
+	p.total.Store(int64(n))
+}
+
+// step records a processed file.
+func (p *progress) step() {
+	p.done++
+	if !p.enabled || time.Since(p.drawn) < progressInterval {
+		return
+	}
+	p.draw()
+}
+
+// finish draws the final count and ends the progress line.
+func (p *progress) finish() {
+	if !p.enabled || !p.printed {
+		return
+	}
+	p.draw()
+	fmt.Fprintln(p.w)
+}
+
+func (p *progress) draw() {
+	if total := p.total.Load(); total >= 0 {
+		fmt.Fprintf(p.w, "\rProcessing files: %d/%d", p.done, total)
+	} else {
+		fmt.Fprintf(p.w, "\rProcessing files: %d", p.done)
+	}
+	p.drawn = time.Now()
+	p.printed = true
+}
+
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
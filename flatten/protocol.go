@@ -0,0 +1,67 @@
+package flatten
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// scpURL matches the scp-like form of SSH URLs, user@host:path.
+var scpURL = regexp.MustCompile(`^(?:[\w.-]+@)?([\w.-]+):([^/].*)$`)
+
+// rewriteProtocol rewrites a remote repository URL to use the given
+// transport, "ssh" or "https", following the conventions of hosts such as
+// GitHub, GitLab and Bitbucket: https://host/owner/repo on one side and
+// git@host:owner/repo.git on the other. Local paths and file:// URLs are
+// returned unchanged.
+func rewriteProtocol(repoURL, protocol string) (string, error) {
+	if protocol != "ssh" && protocol != "https" {
+		return "", fmt.Errorf("unsupported protocol %q", protocol)
+	}
+
+	host, repoPath, ok := splitRemoteURL(repoURL)
+	if !ok {
+		return repoURL, nil
+	}
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+
+	if protocol == "ssh" {
+		return fmt.Sprintf("git@%s:%s.git", host, repoPath), nil
+	}
+	return fmt.Sprintf("https://%s/%s", host, repoPath), nil
+}
+
+// splitRemoteURL returns the host and repository path of an http(s), ssh
+// or scp-like URL.
+func splitRemoteURL(repoURL string) (host, repoPath string, ok bool) {
+	if u, err := url.Parse(repoURL); err == nil && u.Host != "" {
+		switch u.Scheme {
+		case "http", "https", "ssh", "git+ssh":
+			return u.Hostname(), u.Path, true
+		}
+		return "", "", false
+	}
+
+	m := scpURL.FindStringSubmatch(repoURL)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// gistURL matches the page URL of a gist, with or without the owner.
+var gistURL = regexp.MustCompile(`^https?://gist\.github\.com/(?:[\w-]+/)?([0-9a-fA-F]+)/?$`)
+
+// expandGist turns the gist:<id> shorthand and gist page URLs into the
+// clone URL of the gist, which is a Git repository like any other. Other
+// URLs are returned unchanged.
+func expandGist(repoURL string) string {
+	if id, ok := strings.CutPrefix(repoURL, "gist:"); ok {
+		return "https://gist.github.com/" + id + ".git"
+	}
+	if m := gistURL.FindStringSubmatch(repoURL); m != nil {
+		return "https://gist.github.com/" + m[1] + ".git"
+	}
+	return repoURL
+}
@@ -0,0 +1,39 @@
+package flatten
+
+import "testing"
+
+func TestRewriteProtocol(t *testing.T) {
+	tests := []struct {
+		url, protocol, want string
+		wantErr             bool
+	}{
+		{"https://github.com/owner/repo", "ssh", "git@github.com:owner/repo.git", false},
+		{"https://github.com/owner/repo.git", "ssh", "git@github.com:owner/repo.git", false},
+		{"https://github.com/owner/repo/", "ssh", "git@github.com:owner/repo.git", false},
+		{"https://gitlab.com/group/sub/repo", "ssh", "git@gitlab.com:group/sub/repo.git", false},
+		{"https://github.com/owner/repo", "https", "https://github.com/owner/repo", false},
+		{"git@github.com:owner/repo.git", "https", "https://github.com/owner/repo", false},
+		{"github.com:owner/repo", "https", "https://github.com/owner/repo", false},
+		{"ssh://git@github.com/owner/repo.git", "https", "https://github.com/owner/repo", false},
+		{"ssh://git@host:2222/owner/repo.git", "https", "https://host/owner/repo", false},
+		{"git@github.com:owner/repo.git", "ssh", "git@github.com:owner/repo.git", false},
+
+		// Local paths and file:// URLs are left alone.
+		{"/src/repo", "ssh", "/src/repo", false},
+		{"./repo", "https", "./repo", false},
+		{"file:///src/repo", "ssh", "file:///src/repo", false},
+
+		{"https://github.com/owner/repo", "git", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := rewriteProtocol(tt.url, tt.protocol)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("rewriteProtocol(%q, %q) error = %v, wantErr %v", tt.url, tt.protocol, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("rewriteProtocol(%q, %q) = %q, want %q", tt.url, tt.protocol, got, tt.want)
+		}
+	}
+}
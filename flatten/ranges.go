@@ -0,0 +1,81 @@
+package flatten
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// listFlag is a flag that can be given multiple times.
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// lineRange is an inclusive, 1-based range of lines of a file.
+type lineRange struct {
+	Start, End int
+}
+
+// parseRanges parses path:start-end (or path:line) specs into line ranges
+// keyed by cleaned repo-relative path, so ./main.go and main.go are the
+// same file. A path can be given several times.
+func parseRanges(specs []string) (map[string][]lineRange, error) {
+	ranges := make(map[string][]lineRange)
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid range %q: expected path:start-end", spec)
+		}
+		name, span := spec[:i], spec[i+1:]
+
+		startStr, endStr, found := strings.Cut(span, "-")
+		if !found {
+			endStr = startStr
+		}
+		start, err := strconv.Atoi(startStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q: %w", spec, err)
+		}
+		end, err := strconv.Atoi(endStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q: %w", spec, err)
+		}
+		if start < 1 || end < start {
+			return nil, fmt.Errorf("invalid range %q: lines must satisfy 1 <= start <= end", spec)
+		}
+
+		name = path.Clean(strings.TrimPrefix(name, "/"))
+		if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("invalid range %q: path must name a file in the repository", spec)
+		}
+		ranges[name] = append(ranges[name], lineRange{Start: start, End: end})
+	}
+	return ranges, nil
+}
+
+// extractRange returns lines r.Start through r.End of content. Ranges that
+// extend past the end of the file are clamped; ok is false when the range
+// starts beyond the last line. Mismatches are reported on stderr.
+func extractRange(name, content string, r lineRange) (excerpt string, clamped lineRange, ok bool) {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if r.Start > len(lines) {
+		warnf("Range %d-%d of %s starts beyond its %d lines, skipping\n", r.Start, r.End, name, len(lines))
+		return "", r, false
+	}
+	if r.End > len(lines) {
+		warnf("Range %d-%d of %s extends beyond its %d lines, truncating\n", r.Start, r.End, name, len(lines))
+		r.End = len(lines)
+	}
+
+	return strings.Join(lines[r.Start-1:r.End], ""), r, true
+}
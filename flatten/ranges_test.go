@@ -0,0 +1,64 @@
+package flatten
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRanges(t *testing.T) {
+	tests := []struct {
+		specs   []string
+		want    map[string][]lineRange
+		wantErr bool
+	}{
+		{[]string{"main.go:1-10"}, map[string][]lineRange{"main.go": {{1, 10}}}, false},
+		{[]string{"main.go:5"}, map[string][]lineRange{"main.go": {{5, 5}}}, false},
+		{[]string{"./main.go:1-10"}, map[string][]lineRange{"main.go": {{1, 10}}}, false},
+		{[]string{"/cmd//x.go:2-3"}, map[string][]lineRange{"cmd/x.go": {{2, 3}}}, false},
+		{[]string{"a.go:1-2", "./a.go:8-9"}, map[string][]lineRange{"a.go": {{1, 2}, {8, 9}}}, false},
+		{[]string{"c:/x.go:3"}, map[string][]lineRange{"c:/x.go": {{3, 3}}}, false},
+
+		{[]string{"main.go"}, nil, true},
+		{[]string{":1-2"}, nil, true},
+		{[]string{"main.go:a-b"}, nil, true},
+		{[]string{"main.go:0-2"}, nil, true},
+		{[]string{"main.go:5-2"}, nil, true},
+		{[]string{"../main.go:1"}, nil, true},
+		{[]string{".:1"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRanges(tt.specs)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRanges(%q) error = %v, wantErr %v", tt.specs, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRanges(%q) = %v, want %v", tt.specs, got, tt.want)
+		}
+	}
+}
+
+func TestExtractRange(t *testing.T) {
+	const content = "one\ntwo\nthree\nfour\n"
+
+	tests := []struct {
+		r           lineRange
+		want        string
+		wantClamped lineRange
+		wantOK      bool
+	}{
+		{lineRange{1, 1}, "one\n", lineRange{1, 1}, true},
+		{lineRange{2, 3}, "two\nthree\n", lineRange{2, 3}, true},
+		{lineRange{1, 4}, content, lineRange{1, 4}, true},
+		{lineRange{3, 10}, "three\nfour\n", lineRange{3, 4}, true},
+		{lineRange{5, 6}, "", lineRange{5, 6}, false},
+	}
+
+	for _, tt := range tests {
+		got, clamped, ok := extractRange("test.txt", content, tt.r)
+		if got != tt.want || clamped != tt.wantClamped || ok != tt.wantOK {
+			t.Errorf("extractRange(%v) = %q, %v, %v, want %q, %v, %v", tt.r, got, clamped, ok, tt.want, tt.wantClamped, tt.wantOK)
+		}
+	}
+}
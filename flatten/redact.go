@@ -0,0 +1,116 @@
+package flatten
+
+import (
+	"math"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// secretPatterns match well-known credential formats. Each match is
+// replaced as a whole.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`),
+}
+
+// assignmentPattern matches values assigned to suspicious keys, such as
+// password="hunter2" or "api_key": "abc123", quoted or not. Whether the
+// value is a literal secret is left to secretValue.
+var assignmentPattern = regexp.MustCompile(`(?i)\b((?:[a-z0-9_]*[_-])?(?:password|passwd|pwd|secret|api[_-]?key|access[_-]?key|auth[_-]?token|access[_-]?token))(["']?\s*[:=]\s*)(?:(["'])([^"'\n]*)(["'])|([^\s"',;)]+))`)
+
+// bareSecret matches unquoted values made of the characters of passwords
+// and tokens. Member accesses and calls, such as request.form["password"]
+// or getenv("PASSWORD"), do not match.
+var bareSecret = regexp.MustCompile(`^[A-Za-z0-9_\-+/=~!@#$%^&*]+$`)
+
+// Values shorter than these are too short to be secrets, such as "" or
+// "pw" in tests, or type names such as "string".
+const (
+	minQuotedSecretLen = 4
+	minBareSecretLen   = 8
+)
+
+// secretValue reports whether value, assigned to a suspicious key, is a
+// literal secret rather than code or a placeholder. Unquoted values must
+// also contain a digit, which sets tokens apart from identifiers.
+func secretValue(value string, quoted bool) bool {
+	if value == "" || value == redacted || strings.HasPrefix(value, "$") || strings.HasPrefix(value, "<") || strings.HasPrefix(value, "{") || strings.HasPrefix(value, "%") {
+		return false
+	}
+	if strings.Trim(value, value[:1]) == "" {
+		// A run of one character, such as "****".
+		return false
+	}
+	if quoted {
+		return len(value) >= minQuotedSecretLen
+	}
+	return len(value) >= minBareSecretLen && bareSecret.MatchString(value) && strings.ContainsAny(value, "0123456789")
+}
+
+// tokenPattern matches long runs of characters commonly used in tokens and
+// keys. Matches are only redacted when they look random enough.
+var tokenPattern = regexp.MustCompile(`[A-Za-z0-9+/_=-]{32,}`)
+
+// minTokenEntropy is the Shannon entropy, in bits per character, above
+// which a token is considered a secret. Hex digests stay below it.
+const minTokenEntropy = 4.5
+
+// redact replaces secrets in content with [REDACTED] and returns the
+// result along with the number of redactions made.
+func redact(content string) (string, int) {
+	count := 0
+
+	for _, re := range secretPatterns {
+		content = re.ReplaceAllStringFunc(content, func(string) string {
+			count++
+			return redacted
+		})
+	}
+
+	content = assignmentPattern.ReplaceAllStringFunc(content, func(match string) string {
+		m := assignmentPattern.FindStringSubmatch(match)
+		if m[3] != "" {
+			if m[3] != m[5] || !secretValue(m[4], true) {
+				return match
+			}
+			count++
+			return m[1] + m[2] + m[3] + redacted + m[5]
+		}
+		if !secretValue(m[6], false) {
+			return match
+		}
+		count++
+		return m[1] + m[2] + redacted
+	})
+
+	content = tokenPattern.ReplaceAllStringFunc(content, func(match string) string {
+		if entropy(match) < minTokenEntropy {
+			return match
+		}
+		count++
+		return redacted
+	})
+
+	return content, count
+}
+
+// entropy returns the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	freq := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		freq[r]++
+		n++
+	}
+
+	var h float64
+	for _, c := range freq {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
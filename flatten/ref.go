@@ -0,0 +1,342 @@
+package flatten
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+// resolveCommit resolves a branch, tag or commit hash to a commit. Branches
+// of a fresh clone only exist as remote-tracking refs, so those are tried
+// as well.
+func resolveCommit(repo *git.Repository, rev string) (*object.Commit, error) {
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		var remoteErr error
+		hash, remoteErr = repo.ResolveRevision(plumbing.Revision(git.DefaultRemoteName + "/" + rev))
+		if remoteErr != nil {
+			return nil, fmt.Errorf("error resolving %s: %w", rev, err)
+		}
+	}
+
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("error getting commit for %s: %w", rev, err)
+	}
+	return commit, nil
+}
+
+// targetCommit returns the commit named by ref, or the HEAD commit when ref
+// is empty.
+func targetCommit(repo *git.Repository, ref string) (*object.Commit, error) {
+	if ref != "" {
+		return resolveCommit(repo, ref)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("error getting HEAD: %w", err)
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("error getting commit: %w", err)
+	}
+	return commit, nil
+}
+
+// targetTree returns the tree of the commit to flatten.
+func targetTree(repo *git.Repository, ref string) (*object.Tree, error) {
+	commit, err := targetCommit(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("error getting tree: %w", err)
+	}
+	return tree, nil
+}
+
+// addedFiles returns the paths of the files in tree that do not exist in
+// the tree of base.
+func addedFiles(repo *git.Repository, tree *object.Tree, base string) (map[string]bool, error) {
+	commit, err := resolveCommit(repo, base)
+	if err != nil {
+		return nil, err
+	}
+
+	baseTree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("error getting tree for %s: %w", base, err)
+	}
+
+	changes, err := object.DiffTree(baseTree, tree)
+	if err != nil {
+		return nil, fmt.Errorf("error comparing with %s: %w", base, err)
+	}
+
+	added := make(map[string]bool)
+	for _, change := range changes {
+		action, err := change.Action()
+		if err != nil {
+			return nil, err
+		}
+		if action == merkletrie.Insert {
+			added[change.To.Name] = true
+		}
+	}
+	return added, nil
+}
+
+// listRefs prints the branches and tags of a remote repository without
+// cloning it, so a value for -ref can be picked. It authenticates the way
+// a clone does, asking for credentials when the server wants them.
+func listRefs(ctx context.Context, w io.Writer, opts *Options) error {
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{opts.RepoURL},
+	})
+
+	var refs []*plumbing.Reference
+	err := withAuthPrompt(opts, func() error {
+		var err error
+		refs, err = remote.ListContext(ctx, &git.ListOptions{Auth: opts.Auth})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error listing refs: %w", err)
+	}
+
+	var branches, tags []string
+	for _, ref := range refs {
+		switch name := ref.Name(); {
+		case name.IsBranch():
+			branches = append(branches, name.Short())
+		case name.IsTag():
+			tags = append(tags, name.Short())
+		}
+	}
+	sort.Strings(branches)
+	sort.Strings(tags)
+
+	fmt.Fprintln(w, "Branches:")
+	for _, branch := range branches {
+		fmt.Fprintf(w, "  %s\n", branch)
+	}
+	fmt.Fprintln(w, "Tags:")
+	for _, tag := range tags {
+		fmt.Fprintf(w, "  %s\n", tag)
+	}
+	return nil
+}
+
+// commitEntry returns the commit named by ref, or HEAD, as an entry for
+// -with-commit-message: a name for the separator and a text with the
+// author, date and message.
+func commitEntry(repo *git.Repository, ref string) (name, text string, err error) {
+	commit, err := targetCommit(repo, ref)
+	if err != nil {
+		return "", "", err
+	}
+
+	text = fmt.Sprintf("Author: %s <%s>\nDate:   %s\n\n%s",
+		commit.Author.Name, commit.Author.Email,
+		commit.Author.When.Format(time.RFC1123Z),
+		strings.TrimRight(commit.Message, "\n")+"\n")
+	return "commit " + commit.Hash.String(), text, nil
+}
+
+// changedSince returns the paths changed by the commits reachable from
+// from that were committed after cutoff, which are the files whose last
+// change is that recent. It walks the history once, newest first, and
+// stops at the first older commit, so its cost grows with the number of
+// recent commits rather than with the number of files times the length of
+// the history, as running blame on every file would.
+func changedSince(repo *git.Repository, from *object.Commit, cutoff time.Time) (map[string]bool, error) {
+	commits, err := repo.Log(&git.LogOptions{From: from.Hash, Order: git.LogOrderCommitterTime})
+	if err != nil {
+		return nil, fmt.Errorf("error reading history: %w", err)
+	}
+	defer commits.Close()
+
+	changed := make(map[string]bool)
+	err = commits.ForEach(func(commit *object.Commit) error {
+		if commit.Committer.When.Before(cutoff) {
+			return storer.ErrStop
+		}
+
+		tree, err := commit.Tree()
+		if err != nil {
+			return err
+		}
+
+		// A root commit adds everything, so it is compared with an empty
+		// tree.
+		parentTree := &object.Tree{}
+		if commit.NumParents() > 0 {
+			parent, err := commit.Parent(0)
+			if err != nil {
+				return err
+			}
+			parentTree, err = parent.Tree()
+			if err != nil {
+				return err
+			}
+		}
+
+		changes, err := object.DiffTree(parentTree, tree)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			if change.To.Name != "" {
+				changed[change.To.Name] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading history: %w", err)
+	}
+	return changed, nil
+}
+
+// pullRequestRef returns the ref under which the host of url publishes the
+// head of pull request n. GitLab calls them merge requests and keeps them
+// under refs/merge-requests; GitHub, Gitea and most others use refs/pull.
+func pullRequestRef(url string, n int) string {
+	if strings.Contains(strings.ToLower(url), "gitlab") {
+		return fmt.Sprintf("refs/merge-requests/%d/head", n)
+	}
+	return fmt.Sprintf("refs/pull/%d/head", n)
+}
+
+// isSpecialRef reports whether ref is a full ref name that a clone does not
+// fetch, such as refs/pull/123/head.
+func isSpecialRef(ref string) bool {
+	name := plumbing.ReferenceName(ref)
+	return strings.HasPrefix(ref, "refs/") && !name.IsBranch() && !name.IsTag() && !name.IsRemote()
+}
+
+// fetchSpecialRefs fetches the refs in refs that a clone leaves out, so
+// they can be resolved like any branch afterwards.
+func fetchSpecialRefs(ctx context.Context, repo *git.Repository, opts *Options, refs []string) error {
+	var specs []gitconfig.RefSpec
+	for _, ref := range refs {
+		if isSpecialRef(ref) {
+			specs = append(specs, gitconfig.RefSpec("+"+ref+":"+ref))
+		}
+	}
+	if len(specs) == 0 {
+		return nil
+	}
+
+	log := opts.log()
+	start := time.Now()
+	log.Info("fetch started", "url", opts.RepoURL, "refs", specs)
+	err := repo.FetchContext(ctx, &git.FetchOptions{RefSpecs: specs, Auth: opts.Auth, Force: true})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		log.Error("fetch failed", "url", opts.RepoURL, "error", err)
+		return fmt.Errorf("error fetching %s: %w", specs[0].Src(), err)
+	}
+	log.Info("fetch finished", "url", opts.RepoURL, "duration", time.Since(start))
+	return nil
+}
+
+// defaultBranch returns the branch the HEAD of a remote repository points
+// to, as advertised in its symref capability, the way git ls-remote
+// --symref reports it.
+func defaultBranch(ctx context.Context, url string, auth transport.AuthMethod) (plumbing.ReferenceName, error) {
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{url},
+	})
+
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", fmt.Errorf("error listing refs: %w", err)
+	}
+
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference && ref.Target().IsBranch() {
+			return ref.Target(), nil
+		}
+	}
+	return "", fmt.Errorf("%s does not advertise its default branch", url)
+}
+
+// detectDefaultBranch sets opts.DefaultBranch for -detect-default-branch,
+// so the clone checks out the branch the remote reports as its default
+// rather than one go-git picks. An explicit -ref needs no default.
+func detectDefaultBranch(ctx context.Context, opts *Options) error {
+	if !opts.DetectDefaultBranch || opts.Ref != "" || opts.DefaultBranch != "" {
+		return nil
+	}
+
+	branch, err := defaultBranch(ctx, opts.RepoURL, opts.Auth)
+	if err != nil {
+		return fmt.Errorf("error detecting the default branch: %w", err)
+	}
+	opts.log().Info("default branch detected", "url", opts.RepoURL, "branch", branch.Short())
+	opts.DefaultBranch = branch
+	return nil
+}
+
+// parseDate parses a -recency-since value, either a date, taken as
+// midnight UTC, or an RFC 3339 timestamp.
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected 2006-01-02 or 2006-01-02T15:04:05Z07:00", value)
+	}
+	return t, nil
+}
+
+// mergeBase returns the best common ancestor of the commit named by ref,
+// or HEAD, and the commit named by other: the commit git diff other...ref
+// compares with. Of several equally good ones, the first is used.
+func mergeBase(repo *git.Repository, ref, other string) (*object.Commit, error) {
+	commit, err := targetCommit(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	otherCommit, err := resolveCommit(repo, other)
+	if err != nil {
+		return nil, err
+	}
+
+	bases, err := commit.MergeBase(otherCommit)
+	if err != nil {
+		return nil, fmt.Errorf("error finding the merge base with %s: %w", other, err)
+	}
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("%s has no common history with %s", refOrHead(ref), other)
+	}
+	return bases[0], nil
+}
+
+// refOrHead returns ref for messages, or HEAD when it is empty.
+func refOrHead(ref string) string {
+	if ref == "" {
+		return "HEAD"
+	}
+	return ref
+}
@@ -0,0 +1,119 @@
+package flatten
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// flattenRepos bundles several repositories into one single-file output,
+// a labeled section per repository in the order they were given. Up to
+// opts.CloneConcurrency repositories are cloned at once. They are then
+// flattened one after the other, so their messages and progress on stderr
+// come in order instead of interleaving.
+//
+// A failed repository stops the others, unless -continue-on-error is set:
+// then the failures are reported, the other repositories are written, and
+// the errors are returned together at the end.
+func flattenRepos(ctx context.Context, w io.Writer, opts *Options) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	repos := make([]*git.Repository, len(opts.Repos))
+	errs := make([]error, len(opts.Repos))
+	sem := make(chan struct{}, opts.CloneConcurrency)
+	var wg sync.WaitGroup
+	for i, repoOpts := range opts.Repos {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if ctx.Err() != nil {
+				errs[i] = ctx.Err()
+				return
+			}
+
+			repo, err := cloneRepo(ctx, repoOpts)
+			if err != nil && ctx.Err() != nil {
+				// Not every transport error wraps the cancellation.
+				errs[i] = ctx.Err()
+				return
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", repoOpts.RepoURL, err)
+				if !opts.ContinueOnError {
+					cancel()
+				}
+				return
+			}
+			repos[i] = repo
+		}()
+	}
+	wg.Wait()
+	if !opts.ContinueOnError {
+		for _, err := range errs {
+			// Repositories stopped by the cancellation only report the
+			// error that caused it.
+			if err != nil && !errors.Is(err, context.Canceled) {
+				return err
+			}
+		}
+	}
+
+	// Each repository is flattened into a buffer of its own, so nothing
+	// is written before all of them have succeeded.
+	outputs := make([]bytes.Buffer, len(opts.Repos))
+	for i, repoOpts := range opts.Repos {
+		if errs[i] != nil {
+			continue
+		}
+		infof("Flattening %s\n", repoOpts.RepoURL)
+		repoOpts.repo = repos[i]
+		err := flattenTo(ctx, &outputs[i], repoOpts)
+		if err != nil {
+			errs[i] = fmt.Errorf("%s: %w", repoOpts.RepoURL, err)
+			if !opts.ContinueOnError {
+				return errs[i]
+			}
+		}
+	}
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			errorf("%v\n", err)
+			failed = append(failed, err)
+		}
+	}
+
+	written := 0
+	for i, repoOpts := range opts.Repos {
+		if errs[i] != nil {
+			continue
+		}
+
+		header := fmt.Sprintf("=== repo: %s ===\n\n", repoOpts.RepoURL)
+		if written > 0 {
+			header = "\n" + header
+		}
+		_, err := io.WriteString(w, header)
+		if err == nil {
+			_, err = outputs[i].WriteTo(w)
+		}
+		if err != nil {
+			return fmt.Errorf("error writing output: %w", err)
+		}
+		written++
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d repositories could not be flattened: %w", len(failed), len(opts.Repos), errors.Join(failed...))
+	}
+	return nil
+}
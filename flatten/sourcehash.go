@@ -0,0 +1,14 @@
+package flatten
+
+import (
+	"fmt"
+	"hash"
+)
+
+// hashFile adds a flattened file to the -print-source-hash digest. The
+// path and length come first, so the boundaries between files are
+// unambiguous and the same files and contents always give the same hash.
+func hashFile(h hash.Hash, name, content string) {
+	fmt.Fprintf(h, "%s\x00%d\x00", name, len(content))
+	h.Write([]byte(content))
+}
@@ -0,0 +1,105 @@
+package flatten
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// flattenToChunks writes single-file output split into numbered files of
+// at most opts.SplitBytes bytes each, flattened_repo.001.txt and so on.
+// Files are never split, so a file larger than the limit gets a chunk of
+// its own. Every chunk starts with a line saying which of how many it is,
+// which is only known once all files are in, so the chunks are built in
+// memory first.
+func flattenToChunks(ctx context.Context, opts *Options) error {
+	err := createDest(opts)
+	if err != nil {
+		return err
+	}
+
+	repo, err := cloneRepo(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	tree, err := targetTree(repo, opts.Ref)
+	if err != nil {
+		return err
+	}
+
+	format := newFormatter(opts)
+	limit := opts.SplitBytes - int64(len(chunkHeader(999, 999, opts)))
+	if opts.BOM {
+		limit -= int64(len(utf8BOM))
+	}
+
+	var chunks []*bytes.Buffer
+	add := func(name, content string) error {
+		var entry bytes.Buffer
+		err := format.file(&entry, name, content)
+		if err != nil {
+			return err
+		}
+
+		if int64(entry.Len()) > limit {
+			warnf("File %s is larger than -split-bytes and gets a chunk of its own\n", name)
+		}
+		if len(chunks) == 0 || int64(chunks[len(chunks)-1].Len()+entry.Len()) > limit {
+			chunks = append(chunks, &bytes.Buffer{})
+		}
+		_, err = chunks[len(chunks)-1].Write(entry.Bytes())
+		return err
+	}
+
+	if opts.WithCommitMessage {
+		name, text, err := commitEntry(repo, opts.Ref)
+		if err == nil {
+			err = add(name, text)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err = processFiles(ctx, repo, tree, opts, func(f *object.File, content string) error {
+		return add(displayPath(f.Name, opts), content)
+	})
+	if err != nil {
+		return fmt.Errorf("error processing files: %w", err)
+	}
+
+	for i, chunk := range chunks {
+		name := filepath.Join(opts.DestFolder, fmt.Sprintf("flattened_repo.%03d%s", i+1, format.ext()))
+		data := append([]byte(chunkHeader(i+1, len(chunks), opts)), chunk.Bytes()...)
+		if opts.BOM {
+			data = append([]byte(utf8BOM), data...)
+		}
+		err = writeOutput(name, data, opts)
+		if err != nil {
+			return fmt.Errorf("error writing %s: %w", name, err)
+		}
+	}
+
+	infof("Split the output into %d chunk(s)\n", len(chunks))
+	return nil
+}
+
+// chunkHeader returns the line that starts chunk i of n, as a comment in
+// document formats so it does not disturb the rendering.
+func chunkHeader(i, n int, opts *Options) string {
+	line := fmt.Sprintf("Chunk %d of %d", i, n)
+	switch {
+	case opts.Format == "markdown":
+		return fmt.Sprintf("<!-- %s -->\n\n", line)
+	case opts.Format == "org":
+		return fmt.Sprintf("# %s\n\n", line)
+	case opts.Comment != "":
+		return fmt.Sprintf("%s === %s ===\n\n", opts.Comment, line)
+	default:
+		return fmt.Sprintf("=== %s ===\n\n", line)
+	}
+}
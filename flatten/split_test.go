@@ -0,0 +1,64 @@
+package flatten
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChunksWithinLimit(t *testing.T) {
+	// Enough files for three-digit chunk numbers, whose header fills the
+	// room set aside for it, plus one larger than any chunk.
+	files := map[string]string{"big.txt": strings.Repeat("big\n", 200)}
+	for i := 0; i < 250; i++ {
+		files[fmt.Sprintf("f%03d.txt", i)] = "some content\n"
+	}
+	repo, _ := testRepo(t, files)
+
+	// Without -bom, two files fill a chunk up to the limit exactly.
+	var entry bytes.Buffer
+	opts := &Options{Jobs: 1, Quiet: true, repo: repo}
+	if err := newFormatter(opts).file(&entry, "f000.txt", "some content\n"); err != nil {
+		t.Fatal(err)
+	}
+	limit := len(chunkHeader(999, 999, opts)) + 2*entry.Len()
+
+	for _, bom := range []bool{false, true} {
+		dest := t.TempDir()
+		opts := &Options{Jobs: 1, Quiet: true, SplitBytes: int64(limit), BOM: bom, DestFolder: dest, repo: repo}
+		if err := flattenToChunks(context.Background(), opts); err != nil {
+			t.Fatal(err)
+		}
+
+		chunks, err := filepath.Glob(filepath.Join(dest, "flattened_repo.*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunks) < 100 {
+			t.Fatalf("-bom %v: %d chunks, want at least 100", bom, len(chunks))
+		}
+		for _, chunk := range chunks {
+			data, err := os.ReadFile(chunk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bom != bytes.HasPrefix(data, []byte(utf8BOM)) {
+				t.Errorf("-bom %v: %s starts with %q", bom, filepath.Base(chunk), data[:3])
+			}
+			// The file larger than the limit gets a chunk of its own.
+			if bytes.Contains(data, []byte("big.txt")) {
+				if bytes.Contains(data, []byte("f0")) {
+					t.Errorf("-bom %v: %s holds other files next to big.txt", bom, filepath.Base(chunk))
+				}
+				continue
+			}
+			if len(data) > limit {
+				t.Errorf("-bom %v: %s is %d bytes, over the limit of %d", bom, filepath.Base(chunk), len(data), limit)
+			}
+		}
+	}
+}
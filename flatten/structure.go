@@ -0,0 +1,92 @@
+package flatten
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// preservedPath returns where a file is written with -preserve-structure:
+// at its repository path below the destination folder. Names that would
+// land outside of it, such as absolute paths or ones climbing out with
+// "..", are rejected.
+func preservedPath(destFolder, name string) (string, error) {
+	clean := path.Clean(name)
+	if path.IsAbs(clean) || filepath.IsAbs(filepath.FromSlash(clean)) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("refusing to write %q outside of the destination folder", name)
+	}
+	return filepath.Join(destFolder, filepath.FromSlash(clean)), nil
+}
+
+// pruneCheckout removes everything from a checkout in destFolder that was
+// not written by -preserve-structure: the .git directory, the files that
+// were filtered out and, unless keepEmpty is set, the directories left
+// without any files.
+func pruneCheckout(destFolder string, written map[string]bool, keepEmpty bool) error {
+	err := os.RemoveAll(filepath.Join(destFolder, git.GitDirName))
+	if err != nil {
+		return err
+	}
+
+	var dirs []string
+	var errs []error
+	err = filepath.WalkDir(destFolder, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != destFolder {
+				dirs = append(dirs, p)
+			}
+			return nil
+		}
+		if !written[p] {
+			err := os.Remove(p)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("could not remove %s: %w", p, err))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !keepEmpty {
+		// Deepest first, so parents are empty by the time they are reached.
+		sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+		for _, dir := range dirs {
+			entries, err := os.ReadDir(dir)
+			if err == nil && len(entries) == 0 {
+				err = os.Remove(dir)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("could not remove %s: %w", dir, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// createSkeleton creates every directory of tree, or of its subpath, below
+// the destination folder, for -keep-empty-dirs without a checkout.
+func createSkeleton(tree *object.Tree, opts *Options) error {
+	return tree.Files().ForEach(func(f *object.File) error {
+		if !inDir(f.Name, opts.Subpath) {
+			return nil
+		}
+		target, err := preservedPath(opts.DestFolder, f.Name)
+		if err != nil {
+			return err
+		}
+		return os.MkdirAll(filepath.Dir(target), 0755)
+	})
+}
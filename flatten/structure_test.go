@@ -0,0 +1,40 @@
+package flatten
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPreservedPath(t *testing.T) {
+	dest := filepath.FromSlash("/out")
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"main.go", "/out/main.go", false},
+		{"cmd/tool/main.go", "/out/cmd/tool/main.go", false},
+		{"a/../b.go", "/out/b.go", false},
+		{"./a/b.go", "/out/a/b.go", false},
+		{"..foo/x", "/out/..foo/x", false},
+
+		{"/etc/passwd", "", true},
+		{"..", "", true},
+		{"../x", "", true},
+		{"a/../../x", "", true},
+		{".", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := preservedPath(dest, tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("preservedPath(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if want := filepath.FromSlash(tt.want); got != want {
+			t.Errorf("preservedPath(%q) = %q, want %q", tt.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package flatten
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// processSubmodules clones every submodule listed in the .gitmodules file
+// of tree and calls visit for each of its files, named by their path
+// relative to the top-level repository. Nested submodules are walked too.
+//
+// tree.Files() does not descend into submodules on its own: gitlink entries
+// only record the commit the submodule is pinned to.
+func processSubmodules(ctx context.Context, tree *object.Tree, parentURL, prefix string, opts *Options, visit func(f *object.File) error) error {
+	file, err := tree.File(".gitmodules")
+	if err == object.ErrFileNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading .gitmodules: %w", err)
+	}
+
+	content, err := file.Contents()
+	if err != nil {
+		return fmt.Errorf("error reading .gitmodules: %w", err)
+	}
+
+	modules := gitconfig.NewModules()
+	err = modules.Unmarshal([]byte(content))
+	if err != nil {
+		return fmt.Errorf("error parsing .gitmodules: %w", err)
+	}
+
+	for _, sub := range modules.Submodules {
+		entry, err := tree.FindEntry(sub.Path)
+		if err != nil || entry.Mode != filemode.Submodule {
+			continue
+		}
+
+		subPath := path.Join(prefix, sub.Path)
+		if !inDir(subPath, opts.Subpath) && !inDir(opts.Subpath, subPath) {
+			continue
+		}
+
+		subURL := resolveSubmoduleURL(parentURL, sub.URL)
+		repo, err := cloneRepo(ctx, submoduleOptions(opts, parentURL, subURL))
+		if err != nil {
+			return fmt.Errorf("error cloning submodule %s: %w", subPath, err)
+		}
+
+		commit, err := repo.CommitObject(entry.Hash)
+		if err != nil {
+			return fmt.Errorf("error getting commit %s of submodule %s: %w", entry.Hash, subPath, err)
+		}
+
+		subTree, err := commit.Tree()
+		if err != nil {
+			return fmt.Errorf("error getting tree of submodule %s: %w", subPath, err)
+		}
+
+		err = subTree.Files().ForEach(func(f *object.File) error {
+			f.Name = path.Join(subPath, f.Name)
+			if !inDir(f.Name, opts.Subpath) {
+				return nil
+			}
+			return visit(f)
+		})
+		if err != nil {
+			return err
+		}
+
+		err = processSubmodules(ctx, subTree, subURL, subPath, opts, visit)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// submoduleOptions returns the options a submodule at subURL is cloned
+// with: those of its parent, cached or mirrored the same way, without the
+// ref selection that only applies to the parent. The credentials of the
+// parent are only sent to a submodule on the same host.
+func submoduleOptions(opts *Options, parentURL, subURL string) *Options {
+	subOpts := *opts
+	subOpts.RepoURL = subURL
+	subOpts.repo = nil
+	subOpts.Ref, subOpts.Refs = "", nil
+	subOpts.DetectDefaultBranch, subOpts.DefaultBranch = false, ""
+	subOpts.FileList = nil
+	subOpts.Local, subOpts.Archive, subOpts.CacheDir = false, false, ""
+	configureRepo(&subOpts, false, opts.CacheDir)
+	if !sameHost(parentURL, subURL) {
+		subOpts.Auth = nil
+	}
+	return &subOpts
+}
+
+// sameHost reports whether two repository URLs name the same host. Local
+// paths and scp-like URLs have no host and never match.
+func sameHost(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil || ua.Host == "" {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Host, ub.Host)
+}
+
+// resolveSubmoduleURL resolves a submodule URL relative to the URL of its
+// parent repository, the way git does for URLs starting with ./ or ../.
+func resolveSubmoduleURL(parent, rel string) string {
+	if !strings.HasPrefix(rel, "./") && !strings.HasPrefix(rel, "../") {
+		return rel
+	}
+
+	if u, err := url.Parse(parent); err == nil && u.Scheme != "" && u.Host != "" {
+		u.Path = path.Join(u.Path, rel)
+		return u.String()
+	}
+
+	// scp-like syntax: git@github.com:owner/repo.git
+	if i := strings.Index(parent, ":"); i > 0 && !strings.Contains(parent[:i], "/") {
+		return parent[:i+1] + path.Join(parent[i+1:], rel)
+	}
+
+	return path.Join(parent, rel)
+}
+
+// inDir reports whether the slash separated path name is dir or lies
+// below it. Every path is in the empty dir.
+func inDir(name, dir string) bool {
+	return dir == "" || name == dir || strings.HasPrefix(name, dir+"/")
+}
@@ -0,0 +1,27 @@
+package flatten
+
+import "testing"
+
+func TestResolveSubmoduleURL(t *testing.T) {
+	tests := []struct {
+		parent, rel, want string
+	}{
+		{"https://github.com/owner/repo.git", "../lib.git", "https://github.com/owner/lib.git"},
+		{"https://github.com/owner/repo", "../../other/lib", "https://github.com/other/lib"},
+		{"https://github.com/owner/repo", "./sub", "https://github.com/owner/repo/sub"},
+		{"git@github.com:owner/repo.git", "../lib.git", "git@github.com:owner/lib.git"},
+		{"/src/repo", "../lib", "/src/lib"},
+		{"src/repo", "./sub", "src/repo/sub"},
+
+		// Absolute URLs are used as they are.
+		{"https://github.com/owner/repo", "https://example.com/lib.git", "https://example.com/lib.git"},
+		{"https://github.com/owner/repo", "git@example.com:lib.git", "git@example.com:lib.git"},
+		{"https://github.com/owner/repo", "lib", "lib"},
+	}
+
+	for _, tt := range tests {
+		if got := resolveSubmoduleURL(tt.parent, tt.rel); got != tt.want {
+			t.Errorf("resolveSubmoduleURL(%q, %q) = %q, want %q", tt.parent, tt.rel, got, tt.want)
+		}
+	}
+}
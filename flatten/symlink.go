@@ -0,0 +1,46 @@
+package flatten
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// maxSymlinkHops bounds how many links are followed for one file, which
+// also stops symlink loops.
+const maxSymlinkHops = 40
+
+var errSymlinkEscapes = errors.New("it points outside the repository")
+
+// resolveSymlink follows the symlink f, and any links it points to, to a
+// regular file of root. Links are resolved within the tree: absolute
+// targets and targets outside the repository root are refused.
+func resolveSymlink(root *object.Tree, f *object.File) (*object.File, error) {
+	for hops := 0; f.Mode == filemode.Symlink; hops++ {
+		if hops == maxSymlinkHops {
+			return nil, errors.New("too many levels of symlinks")
+		}
+
+		target, err := f.Contents()
+		if err != nil {
+			return nil, err
+		}
+		if path.IsAbs(target) {
+			return nil, errSymlinkEscapes
+		}
+		name := path.Join(path.Dir(f.Name), target)
+		if name == ".." || strings.HasPrefix(name, "../") {
+			return nil, errSymlinkEscapes
+		}
+
+		f, err = root.File(name)
+		if err != nil {
+			return nil, fmt.Errorf("its target %s is not a file in the repository", name)
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,109 @@
+package flatten
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// templateData is what a -template is executed with.
+type templateData struct {
+	Repo   string
+	Ref    string
+	Commit templateCommit
+	Files  []templateFile
+}
+
+type templateCommit struct {
+	Hash    string
+	Author  string
+	Email   string
+	Date    time.Time
+	Message string
+}
+
+type templateFile struct {
+	Path     string
+	Content  string
+	Size     int
+	Ext      string
+	Language string
+}
+
+// loadTemplate parses the -template file. Besides the text/template
+// builtins, templates can use trim, lower, upper and indent.
+func loadTemplate(name string) (*template.Template, error) {
+	tmpl, err := template.New(filepath.Base(name)).Funcs(template.FuncMap{
+		"trim":  strings.TrimSpace,
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+		"indent": func(prefix, s string) string {
+			return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+		},
+	}).ParseFiles(name)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// templateExt returns the extension of the single output file rendered by
+// a template, taken from its name without ".tmpl": "prompt.xml.tmpl"
+// renders to ".xml". Templates without another extension render to ".txt".
+func templateExt(tmpl *template.Template) string {
+	ext := path.Ext(strings.TrimSuffix(tmpl.Name(), ".tmpl"))
+	if ext == "" {
+		return ".txt"
+	}
+	return ext
+}
+
+// renderTemplate selects the files of tree and renders them, all at once,
+// with the -template.
+func renderTemplate(ctx context.Context, w io.Writer, repo *git.Repository, tree *object.Tree, opts *Options) error {
+	commit, err := targetCommit(repo, opts.Ref)
+	if err != nil {
+		return err
+	}
+
+	data := templateData{
+		Repo: opts.RepoURL,
+		Ref:  opts.Ref,
+		Commit: templateCommit{
+			Hash:    commit.Hash.String(),
+			Author:  commit.Author.Name,
+			Email:   commit.Author.Email,
+			Date:    commit.Author.When,
+			Message: strings.TrimRight(commit.Message, "\n"),
+		},
+	}
+
+	err = processFiles(ctx, repo, tree, opts, func(f *object.File, content string) error {
+		name := displayPath(f.Name, opts)
+		data.Files = append(data.Files, templateFile{
+			Path:     name,
+			Content:  content,
+			Size:     len(content),
+			Ext:      path.Ext(name),
+			Language: language(name),
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error processing files: %w", err)
+	}
+
+	err = opts.Template.Execute(w, data)
+	if err != nil {
+		return fmt.Errorf("error rendering template: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package flatten
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// tocEntry is a file as listed in the table of contents.
+type tocEntry struct {
+	name    string
+	content string
+}
+
+// lineCount returns the number of lines in content, counting a final line
+// without a trailing newline.
+func lineCount(content string) int {
+	n := strings.Count(content, "\n")
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		n++
+	}
+	return n
+}
+
+// writeTOC writes a table of contents listing the files of a single-file
+// output. With -toc-stats every entry also shows the size and line count
+// of the content as it appears in the output.
+func writeTOC(w io.Writer, entries []tocEntry, opts *Options) error {
+	heading, item := "Table of contents:", "  %s"
+	if opts.Format == "markdown" {
+		heading, item = "# Table of contents\n", "- `%s`"
+	} else if opts.Comment != "" {
+		heading, item = opts.Comment+" "+heading, opts.Comment+" "+item
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", heading)
+	for _, entry := range entries {
+		fmt.Fprintf(&b, item, entry.name)
+		if opts.TOCStats {
+			fmt.Fprintf(&b, " (%d bytes, %d lines)", len(entry.content), lineCount(entry.content))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,49 @@
+package flatten
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"unicode/utf8"
+)
+
+// charsPerToken is the rule of thumb used to estimate token counts: about
+// four characters per token for English text and code.
+const charsPerToken = 4
+
+// estimateTokens returns the estimated number of tokens of content.
+func estimateTokens(content string) int {
+	return (utf8.RuneCountInString(content) + charsPerToken - 1) / charsPerToken
+}
+
+// fileTokens is the estimated token count of an included file.
+type fileTokens struct {
+	Path   string `json:"path"`
+	Tokens int    `json:"tokens"`
+}
+
+// reportTokens writes the estimated token count of every file, largest
+// first, and the total: as a table, or with format "json" as a single
+// JSON object.
+func reportTokens(w io.Writer, files []fileTokens, format string) error {
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Tokens > files[j].Tokens })
+	total := 0
+	for _, f := range files {
+		total += f.Tokens
+	}
+
+	if format == "json" {
+		return json.NewEncoder(w).Encode(struct {
+			Total int          `json:"total_tokens"`
+			Files []fileTokens `json:"files"`
+		}{total, files})
+	}
+
+	fmt.Fprintf(w, "Estimated tokens of %d included file(s):\n", len(files))
+	for _, f := range files {
+		fmt.Fprintf(w, "  %10d  %s\n", f.Tokens, f.Path)
+	}
+	_, err := fmt.Fprintf(w, "  %10d  total\n", total)
+	return err
+}
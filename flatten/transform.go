@@ -0,0 +1,130 @@
+package flatten
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// dedent removes the longest run of leading whitespace shared by all
+// non-blank lines of content. Tabs and spaces are compared literally, so
+// only a prefix that is identical on every line is removed. Blank lines are
+// kept, minus whatever part of the prefix they have.
+func dedent(content string) string {
+	lines := strings.Split(content, "\n")
+
+	prefix := ""
+	found := false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if !found {
+			prefix = indent
+			found = true
+			continue
+		}
+		prefix = commonPrefix(prefix, indent)
+		if prefix == "" {
+			return content
+		}
+	}
+	if prefix == "" {
+		return content
+	}
+
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			lines[i] = line[len(commonPrefix(prefix, line)):]
+			continue
+		}
+		lines[i] = strings.TrimPrefix(line, prefix)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func commonPrefix(a, b string) string {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return a[:i]
+		}
+	}
+	return a[:n]
+}
+
+// wrap hard-wraps lines of content longer than width characters, breaking
+// at the last space that fits and dropping it, or mid-word when a line has
+// no space to break at.
+func wrap(content string, width int) string {
+	lines := strings.Split(content, "\n")
+	var b strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+
+		runes := []rune(line)
+		for len(runes) > width {
+			cut, next := width, width
+			for j := width; j > 0; j-- {
+				if runes[j] == ' ' {
+					cut, next = j, j+1
+					break
+				}
+			}
+			b.WriteString(string(runes[:cut]))
+			b.WriteByte('\n')
+			runes = runes[next:]
+		}
+		b.WriteString(string(runes))
+	}
+	return b.String()
+}
+
+// hasLongLine reports whether any line of content is longer than limit
+// characters, which is typical of minified and generated files.
+func hasLongLine(content string, limit int) bool {
+	for _, line := range strings.Split(content, "\n") {
+		if len(line) > limit && utf8.RuneCountInString(line) > limit {
+			return true
+		}
+	}
+	return false
+}
+
+// squeezeBlank collapses every run of blank (empty or whitespace-only)
+// lines of content into its first line, like cat -s.
+func squeezeBlank(content string) string {
+	return filterLines(content, func(line string, prevBlank bool) bool {
+		return !prevBlank || strings.TrimSpace(line) != ""
+	})
+}
+
+// stripBlank removes every blank line of content.
+func stripBlank(content string) string {
+	return filterLines(content, func(line string, _ bool) bool {
+		return strings.TrimSpace(line) != ""
+	})
+}
+
+// filterLines keeps the lines of content for which keep returns true. keep
+// is told whether the line before was blank. A final newline is kept.
+func filterLines(content string, keep func(line string, prevBlank bool) bool) string {
+	body, newline := strings.CutSuffix(content, "\n")
+	lines := strings.Split(body, "\n")
+	kept := lines[:0]
+	prevBlank := false
+	for _, line := range lines {
+		if keep(line, prevBlank) {
+			kept = append(kept, line)
+		}
+		prevBlank = strings.TrimSpace(line) == ""
+	}
+
+	out := strings.Join(kept, "\n")
+	if newline {
+		out += "\n"
+	}
+	return out
+}
@@ -0,0 +1,51 @@
+package flatten
+
+import "testing"
+
+func TestDedent(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"a\nb\n", "a\nb\n"},
+		{"    a\n    b\n", "a\nb\n"},
+		{"    a\n      b\n    c", "a\n  b\nc"},
+		{"\ta\n\t\tb\n", "a\n\tb\n"},
+		// Tabs and spaces are not interchangeable.
+		{"\ta\n    b\n", "\ta\n    b\n"},
+		{"  \ta\n  b\n", "\ta\nb\n"},
+		// Blank lines do not limit the prefix and lose what they have of it.
+		{"    a\n\n  \n    b\n", "a\n\n\nb\n"},
+		{"  a\nb\n", "  a\nb\n"},
+		{"", ""},
+		{"\n  \n", "\n  \n"},
+	}
+
+	for _, tt := range tests {
+		if got := dedent(tt.in); got != tt.want {
+			t.Errorf("dedent(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"exactly10c", 10, "exactly10c"},
+		{"one two three four", 10, "one two\nthree four"},
+		{"one two three four", 9, "one two\nthree\nfour"},
+		{"abcdefghijklmnop", 5, "abcde\nfghij\nklmno\np"},
+		{"a b\nccc ddd eee", 7, "a b\nccc ddd\neee"},
+		// Width counts characters, not bytes.
+		{"ééééé ééééé", 5, "ééééé\nééééé"},
+	}
+
+	for _, tt := range tests {
+		if got := wrap(tt.in, tt.width); got != tt.want {
+			t.Errorf("wrap(%q, %d) = %q, want %q", tt.in, tt.width, got, tt.want)
+		}
+	}
+}
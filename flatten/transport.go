@@ -0,0 +1,183 @@
+package flatten
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// installHTTPTransport replaces go-git's HTTP and HTTPS transports with
+// one built from opts, when any option needs it.
+func installHTTPTransport(opts *Options) {
+	if opts.MaxCloneSize <= 0 && len(opts.HTTPHeaders) == 0 && opts.Throttle == nil && opts.RootCAs == nil {
+		return
+	}
+
+	c := githttp.NewClient(&http.Client{Transport: httpRoundTripper(opts)})
+	client.InstallProtocol("http", c)
+	client.InstallProtocol("https", c)
+}
+
+// httpRoundTripper returns the transport for HTTP requests made with the
+// options in opts.
+func httpRoundTripper(opts *Options) http.RoundTripper {
+	var rt http.RoundTripper = http.DefaultTransport
+	if opts.RootCAs != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: opts.RootCAs}
+		rt = transport
+	}
+	if len(opts.HTTPHeaders) > 0 {
+		rt = &headerTransport{base: rt, header: opts.HTTPHeaders}
+	}
+	if opts.MaxCloneSize > 0 {
+		rt = &limitTransport{base: rt, limit: opts.MaxCloneSize}
+	}
+	if opts.Throttle != nil {
+		rt = &throttleTransport{base: rt, throttle: opts.Throttle}
+	}
+	return rt
+}
+
+// parseHTTPHeaders parses -http-header values of the form "Key: Value".
+func parseHTTPHeaders(values []string) (http.Header, error) {
+	header := make(http.Header)
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			// The value is left out, as headers usually carry credentials.
+			return nil, fmt.Errorf("invalid -http-header, expected Key: Value")
+		}
+		header.Add(key, strings.TrimSpace(val))
+	}
+	return header, nil
+}
+
+// headerTransport adds headers to every request, for proxies and gateways
+// that require them.
+type headerTransport struct {
+	base   http.RoundTripper
+	header http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, values := range t.header {
+		req.Header[key] = append([]string(nil), values...)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// limitTransport fails requests once the response bodies read through it
+// add up to more than limit bytes, which stops a clone of an unexpectedly
+// large repository early.
+type limitTransport struct {
+	base  http.RoundTripper
+	limit int64
+	read  atomic.Int64
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, t: t}
+	return resp, nil
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	t *limitTransport
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.t.read.Add(int64(n)) > b.t.limit {
+		return n, fmt.Errorf("clone exceeds -max-clone-size of %d bytes", b.t.limit)
+	}
+	return n, err
+}
+
+// throttle caps the rate at which response bodies are read, shared by all
+// the HTTP requests of a run.
+type throttle struct {
+	rate int64
+
+	mu    sync.Mutex
+	start time.Time
+	read  int64
+}
+
+func newThrottle(rate int64) *throttle {
+	return &throttle{rate: rate}
+}
+
+// wait records n more bytes read and sleeps until reading them fits the
+// rate, counted from the first read.
+func (t *throttle) wait(n int) {
+	t.mu.Lock()
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	t.read += int64(n)
+	due := t.start.Add(time.Duration(float64(t.read) / float64(t.rate) * float64(time.Second)))
+	t.mu.Unlock()
+
+	time.Sleep(time.Until(due))
+}
+
+// report prints the number of bytes read and the effective throughput.
+func (t *throttle) report(opts *Options) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.start.IsZero() {
+		return
+	}
+
+	elapsed := time.Since(t.start)
+	throughput := int64(float64(t.read) / elapsed.Seconds())
+	infof("Fetched %d bytes in %s (%d bytes/s)\n", t.read, elapsed.Round(time.Millisecond), throughput)
+	opts.log().Info("fetch throughput", "bytes", t.read, "duration", elapsed, "bytes_per_second", throughput)
+}
+
+// throttleTransport reads response bodies no faster than its throttle
+// allows, so a clone does not saturate a shared or metered link.
+type throttleTransport struct {
+	base     http.RoundTripper
+	throttle *throttle
+}
+
+func (t *throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &throttledBody{ReadCloser: resp.Body, throttle: t.throttle}
+	return resp, nil
+}
+
+type throttledBody struct {
+	io.ReadCloser
+	throttle *throttle
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	// Small reads keep the transfer smooth instead of bursting a whole
+	// buffer and then pausing.
+	if chunk := max(b.throttle.rate/10, 1); int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.throttle.wait(n)
+	return n, err
+}
@@ -0,0 +1,69 @@
+package flatten
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// treeJSON is the document written by -tree-json.
+type treeJSON struct {
+	Commit string          `json:"commit"`
+	Files  []treeJSONEntry `json:"files"`
+}
+
+// treeJSONEntry describes a selected file by its tree entry.
+type treeJSONEntry struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Mode is the octal mode as Git writes it, e.g. 100644 or 100755.
+	Mode string `json:"mode"`
+	Hash string `json:"hash"`
+}
+
+// writeTreeJSON writes the tree entries of the files selected by opts as
+// JSON to w. Like -list-files, it never reads a file: sizes and hashes come
+// from the tree and blob headers.
+func writeTreeJSON(ctx context.Context, w io.Writer, opts *Options) error {
+	repo, err := cloneRepo(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	commit, err := targetCommit(repo, opts.Ref)
+	if err != nil {
+		return err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("error getting tree: %w", err)
+	}
+
+	doc := treeJSON{Commit: commit.Hash.String(), Files: []treeJSONEntry{}}
+	err = processFiles(ctx, repo, tree, opts, func(f *object.File, _ string) error {
+		doc.Files = append(doc.Files, treeJSONEntry{
+			Path: f.Name,
+			Size: f.Size,
+			Mode: fmt.Sprintf("%06o", uint32(f.Mode)),
+			Hash: f.Hash.String(),
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error processing files: %w", err)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if opts.Pretty {
+		enc.SetIndent("", "  ")
+	}
+	err = enc.Encode(doc)
+	if err != nil {
+		return fmt.Errorf("error writing output: %w", err)
+	}
+	return nil
+}
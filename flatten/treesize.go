@@ -0,0 +1,47 @@
+package flatten
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// checkTreeSize is the -max-tree-files preflight. It counts the files of
+// tree, or of its -subpath, from the tree objects alone, so no blob is
+// read, and fails when there are more than the limit.
+func checkTreeSize(tree *object.Tree, opts *Options) error {
+	if opts.Subpath != "" {
+		subtree, err := tree.Tree(opts.Subpath)
+		if err != nil {
+			return fmt.Errorf("error finding subpath %s: %w", opts.Subpath, err)
+		}
+		tree = subtree
+	}
+
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+
+	count := 0
+	for {
+		_, entry, err := walker.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error counting files: %w", err)
+		}
+		if entry.Mode == filemode.Dir || entry.Mode == filemode.Submodule {
+			continue
+		}
+
+		count++
+		if count > opts.MaxTreeFiles {
+			return fmt.Errorf("the tree has more than %d files (-max-tree-files); narrow it down with -subpath, or use -force to process it anyway", opts.MaxTreeFiles)
+		}
+	}
+	opts.log().Info("tree size checked", "files", count, "max_tree_files", opts.MaxTreeFiles)
+	return nil
+}
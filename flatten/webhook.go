@@ -0,0 +1,111 @@
+package flatten
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// webhookBackoff is the wait before the first retry of a webhook delivery;
+// it doubles with every further attempt.
+const webhookBackoff = time.Second
+
+// postWebhook flattens the repository into memory and POSTs the
+// single-file output to opts.Webhook.
+func postWebhook(ctx context.Context, opts *Options) error {
+	var buf bytes.Buffer
+	err := writeSingle(ctx, &buf, opts)
+	if err != nil {
+		return err
+	}
+	return deliverWebhook(ctx, opts, buf.Bytes())
+}
+
+// deliverWebhook POSTs body to opts.Webhook, retrying connection errors,
+// 429 and 5xx responses up to opts.WebhookRetries times. Other responses
+// are final, as sending the same body again would not change them.
+func deliverWebhook(ctx context.Context, opts *Options, body []byte) error {
+	log := opts.log()
+	client := &http.Client{Transport: webhookTransport(opts)}
+
+	wait := webhookBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := postOnce(ctx, client, opts, body)
+		if err == nil {
+			log.Info("webhook delivered", "url", opts.Webhook, "bytes", len(body), "attempts", attempt+1)
+			return nil
+		}
+		if !retry || attempt >= opts.WebhookRetries || ctx.Err() != nil {
+			log.Error("webhook failed", "url", opts.Webhook, "attempts", attempt+1, "error", err)
+			return fmt.Errorf("error posting to -webhook: %w", err)
+		}
+
+		log.Info("webhook attempt failed, retrying", "url", opts.Webhook, "attempt", attempt+1, "wait", wait, "error", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return fmt.Errorf("error posting to -webhook: %w", ctx.Err())
+		}
+		wait *= 2
+	}
+}
+
+// postOnce makes one delivery attempt and reports whether a failure is
+// worth retrying.
+func postOnce(ctx context.Context, client *http.Client, opts *Options, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, opts.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", webhookContentType(opts.Format))
+	if opts.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	// Draining the body lets the connection be reused for a retry.
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("server responded %s", resp.Status)
+}
+
+// webhookTransport returns the transport for webhook requests. It trusts
+// -ca-bundle like the clone does, but leaves out -http-header, which is
+// meant for the Git host and often carries its credentials.
+func webhookTransport(opts *Options) http.RoundTripper {
+	if opts.RootCAs == nil {
+		return http.DefaultTransport
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: opts.RootCAs}
+	return transport
+}
+
+// webhookContentType returns the media type of output in format.
+func webhookContentType(format string) string {
+	switch format {
+	case "json":
+		return "application/json"
+	case "jsonl":
+		return "application/x-ndjson"
+	case "csv":
+		return "text/csv; charset=utf-8"
+	case "markdown":
+		return "text/markdown; charset=utf-8"
+	case "org":
+		return "text/org; charset=utf-8"
+	}
+	return "text/plain; charset=utf-8"
+}
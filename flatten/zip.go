@@ -0,0 +1,76 @@
+package flatten
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// flattenToZipFile writes the flattened files as a zip archive to path, or
+// to stdout when path is "-".
+func flattenToZipFile(ctx context.Context, path string, opts *Options) error {
+	if path == "-" {
+		return flattenToZip(ctx, os.Stdout, opts)
+	}
+
+	out, err := createOutput(path, opts)
+	if err != nil {
+		return fmt.Errorf("error creating zip file: %w", err)
+	}
+	defer out.Close()
+
+	err = flattenToZip(ctx, out, opts)
+	if err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// flattenToZip clones the repository into memory and streams the
+// flattened files to w as a zip archive. The archive's central directory
+// is written when the zip writer is closed, so w does not need to support
+// seeking.
+func flattenToZip(ctx context.Context, w io.Writer, opts *Options) error {
+	repo, err := cloneRepo(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	tree, err := targetTree(repo, opts.Ref)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	// An entry cannot be replaced once it is written, so rather than
+	// adding a duplicate entry, later files get a suffix.
+	strategy := opts.CollisionStrategy
+	if strategy == "overwrite" || strategy == "" {
+		strategy = "suffix"
+	}
+	namer := newFlatNamer(strategy)
+	err = processFiles(ctx, repo, tree, opts, func(f *object.File, content string) error {
+		entry, err := zw.Create(namer.name(f.Name))
+		if err != nil {
+			return err
+		}
+		if opts.PathComments {
+			content = withPathComment(f.Name, content)
+		}
+		_, err = io.WriteString(entry, content)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error processing files: %w", err)
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return fmt.Errorf("error finishing zip archive: %w", err)
+	}
+	return nil
+}